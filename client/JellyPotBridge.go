@@ -1,433 +1,245 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"log/slog"
+	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
-	"unsafe"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	"golang.org/x/sys/windows"
-	"golang.org/x/sys/windows/registry"
 	"golang.org/x/term"
 )
 
 // JellyPotConfig holds the application configuration
 type JellyPotConfig struct {
-	ReportingInterval time.Duration  `mapstructure:"reporting-interval"`
-	PotPlayerPath     string         `mapstructure:"pot-player-path"`
-	Jellyfin          JellyfinConfig `mapstructure:"jellyfin"`
+	ReportingInterval time.Duration             `mapstructure:"reporting-interval"`
+	PotPlayerPath     string                    `mapstructure:"pot-player-path"`
+	ClosePlayerOnExit bool                      `mapstructure:"close-player-on-exit"`
+	LogLevel          string                    `mapstructure:"log-level"`
+	StatusAddress     string                    `mapstructure:"status-address"`
+	MetricsAddress    string                    `mapstructure:"metrics-address"`
+	LaunchArgs        []string                  `mapstructure:"launch-args"`
+	DefaultServer     string                    `mapstructure:"default-server"`
+	Servers           map[string]JellyfinConfig `mapstructure:"servers"`
+	Jellyfin          JellyfinConfig            `mapstructure:"jellyfin"`
+
+	profile       string // Name of the selected server profile
+	profileKey    string // Config key of the selected server profile
+	legacyProfile bool   // The default profile comes from the jellyfin section
 }
 
 // JellyfinConfig contains Jellyfin server configuration
 type JellyfinConfig struct {
-	ServerUrl string `mapstructure:"server-url"`
-	Username  string `mapstructure:"username"`
-	Password  string `mapstructure:"password"`
-	DeviceId  string `mapstructure:"device-id"`
+	ServerUrl  string   `mapstructure:"server-url"`
+	ServerUrls []string `mapstructure:"server-urls"` // Alternative addresses, such as LAN and public ones
+	Username   string   `mapstructure:"username"`
+	Password   string   `mapstructure:"password"`
+	DeviceId   string   `mapstructure:"device-id"`
+
+	// Player settings that override the top-level values for this server
+	PotPlayerPath     string   `mapstructure:"pot-player-path"`
+	ClosePlayerOnExit *bool    `mapstructure:"close-player-on-exit"`
+	LaunchArgs        []string `mapstructure:"launch-args"`
 }
 
-// loadConfig reads and parses the configuration file
-func loadConfig() (*JellyPotConfig, error) {
-	exePath, err := os.Executable()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get executable path: %w", err)
-	}
-	viper.AddConfigPath(filepath.Dir(exePath))
-	viper.SetConfigName("config.yaml")
-	viper.SetConfigType("yaml")
-
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	var config JellyPotConfig
-	if err := viper.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
-	}
-	return &config, nil
-}
-
-// Windows message constants for PotPlayer communication
-const (
-	WmUser              = 0x0400
-	PotGetCurrentTime   = 0x5004 // Message to get current playback time
-	PotGetPlayStatus    = 0x5006 // Message to get playback status
-	TicksPerMillisecond = 10000  // Conversion factor for ticks
-)
-
-var (
-	user32            = syscall.NewLazyDLL("user32.dll")
-	procGetClassNameW = user32.NewProc("GetClassNameW")
-)
-
-// GetClassNameW retrieves the class name of a window
-func GetClassNameW(hWnd syscall.Handle, className *uint16, nMaxCount int32) int32 {
-	r1, _, _ := syscall.SyscallN(procGetClassNameW.Addr(),
-		uintptr(hWnd),
-		uintptr(unsafe.Pointer(className)),
-		uintptr(nMaxCount))
-	return int32(r1)
-}
-
-// PotPlayerClassNames contains possible window class names for PotPlayer
-var PotPlayerClassNames = []string{
-	"PotPlayer64",     // 64-bit default class name
-	"PotPlayer",       // 32-bit default class name
-	"PotPlayerMini64", // 64-bit mini mode class name
-	"PotPlayerMini",   // 32-bit mini mode class name
-}
-
-// PotPlayerInfo holds playback information from PotPlayer
-type PotPlayerInfo struct {
-	HWnd         uintptr
-	Status       int
-	EventName    string
-	Milliseconds uintptr
-	Seconds      float64
-	Ticks        int64
-}
-
-// findPotPlayerWindow locates the PotPlayer window using its class names
-func findPotPlayerWindow() (uintptr, error) {
-	// First try FindWindow with known class names
-	for _, class := range PotPlayerClassNames {
-		utf16Class, err := syscall.UTF16PtrFromString(class)
-		if err != nil {
-			return 0, fmt.Errorf("failed to convert class name: %w", err)
-		}
-
-		hWnd, _, err := user32.NewProc("FindWindowW").Call(uintptr(unsafe.Pointer(utf16Class)), 0)
-
-		if hWnd != 0 && errors.Is(err, syscall.Errno(0)) {
-			return hWnd, nil
-		}
-	}
-
-	// If not found, enumerate all windows
-	var hWnd uintptr
-	cb := syscall.NewCallback(func(h syscall.Handle, l uintptr) uintptr {
-		var className [256]uint16
-		GetClassNameW(h, &className[0], int32(len(className)))
-		classNameStr := syscall.UTF16ToString(className[:])
-
-		for _, c := range PotPlayerClassNames {
-			if classNameStr == c {
-				hWnd = uintptr(h)
-				return 0 // Stop enumeration
-			}
+// EnvPrefix is the prefix of the environment variables that override config values,
+// such as JELLYPOT_REPORTING_INTERVAL or JELLYPOT_JELLYFIN_PASSWORD
+const EnvPrefix = "JELLYPOT"
+
+// parseFlags parses the command-line flags and binds them to viper, so each can also be given as
+// a JELLYPOT_* environment variable
+func parseFlags(arguments []string) (*pflag.FlagSet, error) {
+	flags := pflag.NewFlagSet("JellyPotBridge", pflag.ContinueOnError)
+	flags.Usage = func() {}
+	flags.String("config", "", "path of the config file")
+	flags.String("profile", "", "server profile to use")
+	flags.String("server", "", "server URL, overriding the one of the profile")
+	flags.String("player", "", "player executable, overriding pot-player-path")
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+
+	bindConfigEnv(viper.GetViper())
+	for _, name := range []string{"config", "profile", "server", "player"} {
+		if err := viper.BindPFlag(name, flags.Lookup(name)); err != nil {
+			return nil, err
 		}
-		return 1 // Continue enumeration
-	})
-
-	_, _, _ = user32.NewProc("EnumWindows").Call(cb, 0)
-
-	if hWnd != 0 {
-		return hWnd, nil
 	}
-
-	return 0, fmt.Errorf("PotPlayer window not found")
+	return flags, nil
 }
 
-// getPotPlayerInfo retrieves current playback information from PotPlayer
-func getPotPlayerInfo() (*PotPlayerInfo, error) {
-	hWnd, err := findPotPlayerWindow()
-	if err != nil {
-		return nil, fmt.Errorf("failed to find PotPlayer window: %w", err)
-	}
-	sendMessage := user32.NewProc("SendMessageW")
-	if sendMessage.Find() != nil {
-		return nil, fmt.Errorf("failed to get SendMessageW procedure")
-	}
-
-	// Get playback status
-	status, _, _ := sendMessage.Call(hWnd, uintptr(WmUser), uintptr(PotGetPlayStatus), 0)
-	// Get current playback time in milliseconds
-	milliseconds, _, _ := sendMessage.Call(hWnd, uintptr(WmUser), uintptr(PotGetCurrentTime), 0)
-	seconds := float64(milliseconds) / 1000.0
-	ticks := int64(milliseconds) * TicksPerMillisecond
-	eventName := getEventName(int(status))
-
-	return &PotPlayerInfo{
-		HWnd:         hWnd,
-		Status:       int(status),
-		EventName:    eventName,
-		Milliseconds: milliseconds,
-		Seconds:      seconds,
-		Ticks:        ticks,
-	}, nil
-}
-
-// getEventName maps PotPlayer status codes to Jellyfin event names
-func getEventName(status int) string {
-	switch status {
-	case 2:
-		return "timeupdate"
-	case 1:
-		return "pause"
-	case -1:
-		return "stop"
-	default:
-		return "unknown"
+// bindConfigEnv lets JELLYPOT_* environment variables override the config file read by v
+func bindConfigEnv(v *viper.Viper) {
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv()
+	// Keys missing from the config file are only unmarshalled when viper knows them
+	for _, key := range []string{"reporting-interval", "pot-player-path", "close-player-on-exit", "log-level",
+		"status-address", "metrics-address", "default-server", "jellyfin.server-url", "jellyfin.username", "jellyfin.password", "jellyfin.device-id"} {
+		_ = v.BindEnv(key)
 	}
 }
 
-// PlaybackStatusEvent represents the playback status to send to Jellyfin
-type PlaybackStatusEvent struct {
-	PositionTicks          int64  `json:"PositionTicks"`
-	PlaybackStartTimeTicks int64  `json:"PlaybackStartTimeTicks"`
-	PlayMethod             string `json:"PlayMethod"`
-	MediaSourceId          string `json:"MediaSourceId"`
-	CanSeek                bool   `json:"CanSeek"`
-	ItemId                 string `json:"ItemId"`
-	EventName              string `json:"EventName"`
-}
-
-// MediaItem represents a media item from Jellyfin
-type MediaItem struct {
-	Id       string   `json:"Id"`
-	Name     string   `json:"Name"`
-	Type     string   `json:"Type"`
-	UserData UserData `json:"UserData"`
-}
-
-// UserData represents a user data within a Jellyfin media item
-type UserData struct {
-	PlaybackPositionTicks int64  `json:"PlaybackPositionTicks"`
-	ItemId                string `json:"ItemId"`
-}
-
-// JellyPotClient handles communication with the Jellyfin server
-type JellyPotClient struct {
-	serverUrl     string
-	username      string
-	password      string
-	accessToken   string
-	sessionId     string
-	userId        string
-	httpClient    *http.Client
-	deviceName    string
-	deviceId      string
-	clientName    string
-	clientVersion string
-}
-
-// NewJellyPotClient creates a new JellyPotClient instance
-func NewJellyPotClient(serverUrl, username, password string, deviceId string) *JellyPotClient {
-	return &JellyPotClient{
-		serverUrl:     serverUrl,
-		username:      username,
-		password:      password,
-		httpClient:    &http.Client{Timeout: 10 * time.Second},
-		deviceName:    "PotPlayer",
-		deviceId:      deviceId,
-		clientName:    "JellyPot",
-		clientVersion: gVersion,
+// readConfig reads and parses the configuration file
+func readConfig() (*JellyPotConfig, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
 	}
-}
+	viper.SetConfigFile(path)
+	viper.SetConfigType("yaml")
 
-// Authenticate logs into the Jellyfin server and retrieves an access token
-func (c *JellyPotClient) Authenticate() error {
-	type authRequest struct {
-		Username string `json:"Username"`
-		Password string `json:"Pw"`
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, configNotFoundError()
 	}
-
-	type sessionInfo struct {
-		Id     string `json:"Id"`
-		UserId string `json:"UserId"`
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	type authResponse struct {
-		AccessToken string      `json:"AccessToken"`
-		SessionInfo sessionInfo `json:"SessionInfo"`
-	}
+	return parseConfig(viper.GetViper())
+}
 
-	body, err := json.Marshal(authRequest{
-		Username: c.username,
-		Password: c.password,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create auth request: %w", err)
+// parseConfig parses the config file read by v
+func parseConfig(v *viper.Viper) (*JellyPotConfig, error) {
+	var config JellyPotConfig
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
-
-	url := fmt.Sprintf("%s/Users/AuthenticateByName", c.serverUrl)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+	config.normalizeProfiles()
+	if len(config.Servers) == 0 && viper.GetString("server") != "" {
+		// A server given by flag or environment variable needs no profile in the file
+		config.Jellyfin.ServerUrl = viper.GetString("server")
+		config.normalizeProfiles()
 	}
+	return &config, nil
+}
 
-	c.setCommonHeaders(req)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
+// loadConfig reads the configuration file and selects the server profile named by server
+// Without any server configured, it uses server when it is a URL, as sent by the user script, and otherwise
+// looks for one on the local network once the rest of the file is valid
+func loadConfig(ctx context.Context, server string) (*JellyPotConfig, error) {
+	config, err := readConfig()
 	if err != nil {
-		return fmt.Errorf("failed to send auth request: %w", err)
+		return nil, err
 	}
-	defer func(Body io.ReadCloser) { _ = Body.Close() }(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("authentication failed with status code: %d", resp.StatusCode)
-	}
-
-	var authResp authResponse
-	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-		c.accessToken = ""
-		return fmt.Errorf("failed to parse auth response: %w", err)
-	}
-
-	c.accessToken = authResp.AccessToken
-	c.sessionId = authResp.SessionInfo.UserId
-	c.userId = authResp.SessionInfo.UserId
-	return nil
-}
-
-// UpdatePlaybackStatus sends the current playback status to Jellyfin
-func (c *JellyPotClient) UpdatePlaybackStatus(event PlaybackStatusEvent) error {
-	if c.accessToken == "" {
-		if err := c.Authenticate(); err != nil {
-			return err
+	discover := false
+	if len(config.Servers) == 0 {
+		if checkServerUrl(server) == nil {
+			config.Jellyfin.ServerUrl = server
+			printConfigHint(config.serverUrlKey(), server)
+		} else {
+			discover = true
 		}
+		config.addDefaultProfile()
 	}
-
-	reqBody, err := json.Marshal(event)
+	detected, err := config.setupProfile(server)
 	if err != nil {
-		return fmt.Errorf("failed to create playback status request: %w", err)
+		return nil, err
 	}
-
-	url := fmt.Sprintf("%s/Sessions/Playing/Progress", c.serverUrl)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+	if detected {
+		slog.Info("using detected player", "player", config.PotPlayerPath)
 	}
-
-	c.setCommonHeaders(req)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send playback status: %w", err)
+	// An invalid file is left to the setup wizard, which runs discovery itself
+	validate := config.Validate
+	if discover {
+		validate = config.ValidateExceptServer
 	}
-	defer func(Body io.ReadCloser) { _ = Body.Close() }(resp.Body)
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		c.accessToken = "" // Force re-authentication on failure
-		return fmt.Errorf("update playback status failed with code: %d", resp.StatusCode)
+	if err := validate(); err != nil {
+		return nil, err
 	}
-
-	return nil
-}
-
-// GetItem retrieves details about a specific media item from Jellyfin
-func (c *JellyPotClient) GetItem(itemId string) (*MediaItem, error) {
-	if c.accessToken == "" {
-		if err := c.Authenticate(); err != nil {
-			return nil, err
+	if discover {
+		address, err := discoverServerUrl(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("no server-url is configured and discovery failed: %w", err)
 		}
+		printConfigHint(config.serverUrlKey(), address)
+		config.Jellyfin.ServerUrl = address
+		config.Servers[config.profile] = config.Jellyfin
 	}
-
-	url := fmt.Sprintf("%s/Users/%s/Items/%s", c.serverUrl, c.userId, itemId)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	if err := ensureDeviceId(config); err != nil {
+		return nil, err
 	}
+	return config, nil
+}
 
-	c.setCommonHeaders(req)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send item request: %w", err)
-	}
-	defer func(Body io.ReadCloser) { _ = Body.Close() }(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get item failed with status code: %d", resp.StatusCode)
-	}
+// printConfigHint tells the user which value to put in the config file, which is never rewritten
+// so its comments and layout stay as the user wrote them
+func printConfigHint(key string, value any) {
+	fmt.Printf("To keep this setting, set %s to %v in %s\n", key, value, viper.ConfigFileUsed())
+}
 
-	var item MediaItem
-	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
-		c.accessToken = ""
-		return nil, fmt.Errorf("failed to parse item response: %w", err)
+// SampleDeviceId is the device ID shipped in the sample config.yaml
+const SampleDeviceId = "f7c8a374-365a-4545-94ed-94410338f495"
+
+// ensureDeviceId generates a per-machine device ID for the selected profile when the configured
+// one is empty or still the sample value, and keeps it in the per-user data directory
+func ensureDeviceId(config *JellyPotConfig) error {
+	deviceId := resolveDeviceId(config)
+	if deviceId == "" {
+		var err error
+		if deviceId, err = newDeviceId(); err != nil {
+			return fmt.Errorf("failed to generate device ID: %w", err)
+		}
+		if err := config.saveDeviceId(deviceId); err != nil {
+			slog.Warn("failed to save generated device ID", "profile", config.profile, "error", err)
+		}
 	}
-
-	return &item, nil
+	config.Jellyfin.DeviceId = deviceId
+	config.Servers[config.profile] = config.Jellyfin
+	return nil
 }
 
-// setCommonHeaders adds standard headers required by Jellyfin API
-func (c *JellyPotClient) setCommonHeaders(req *http.Request) {
-	if c.accessToken == "" {
-		req.Header.Set("Authorization", fmt.Sprintf(
-			"MediaBrowser Client=\"%s\", Device=\"%s\", DeviceId=\"%s\", Version=\"%s\"",
-			c.clientName, c.deviceName, c.deviceId, c.clientVersion,
-		))
-	} else {
-		req.Header.Set("Authorization", fmt.Sprintf(
-			"MediaBrowser Token=\"%s\", Client=\"%s\", Device=\"%s\", DeviceId=\"%s\", Version=\"%s\"",
-			c.accessToken, c.clientName, c.deviceName, c.deviceId, c.clientVersion,
-		))
+// saveDeviceId keeps the device ID of the selected profile in the per-user data directory, which stays on
+// this machine even when the config directory roams
+func (c *JellyPotConfig) saveDeviceId(deviceId string) error {
+	path := c.DataPath("device-id")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
 	}
+	return os.WriteFile(path, []byte(deviceId), 0o600)
 }
 
-// RegisterProtocol registers a custom URL protocol to launch the current application
-// protocol: The protocol name (e.g., "jellypot")
-// description: Human-readable description of the protocol
-func RegisterProtocol(protocol, description string) {
-	exePath, err := os.Executable()
-	if err != nil {
-		fmt.Printf("Failed to get executable path: %s", err.Error())
-		return
-	}
-	exePath, err = filepath.Abs(exePath)
-	if err != nil {
-		fmt.Printf("Failed to get absolute path: %s", err.Error())
-		return
+// resolveDeviceId returns the configured device ID, or the one generated on an earlier run,
+// without generating or saving anything; it is empty when neither exists
+func resolveDeviceId(config *JellyPotConfig) string {
+	deviceId := strings.TrimSpace(config.Jellyfin.DeviceId)
+	if deviceId != "" && !strings.EqualFold(deviceId, SampleDeviceId) {
+		return deviceId
 	}
-	fmt.Printf("Registering protocol '%s' with handler: %s\n", protocol, exePath)
-	key, _, err := registry.CreateKey(registry.CLASSES_ROOT, protocol, registry.ALL_ACCESS)
-	if err != nil {
-		fmt.Printf("Failed to create main protocol key: %s", err.Error())
-		return
+	if data, err := os.ReadFile(config.DataPath("device-id")); err == nil {
+		return strings.TrimSpace(string(data))
 	}
-	defer func(key registry.Key) { _ = key.Close() }(key)
-	if err := key.SetStringValue("", "URL:"+description); err != nil {
-		fmt.Printf("Failed to set protocol description: %s", err.Error())
-		return
-	}
-	if err := key.SetStringValue("URL Protocol", ""); err != nil {
-		fmt.Printf("Failed to set URL Protocol indicator: %s", err.Error())
-		return
-	}
-	commandPath := fmt.Sprintf("%s\\shell\\open\\command", protocol)
-	cmdKey, _, err := registry.CreateKey(registry.CLASSES_ROOT, commandPath, registry.ALL_ACCESS)
-	if err != nil {
-		fmt.Printf("Failed to create command key: %s", err.Error())
-		return
-	}
-	defer func(cmdKey registry.Key) { _ = cmdKey.Close() }(cmdKey)
-	launchCommand := fmt.Sprintf(`"%s" "%%1"`, exePath)
-	if err := cmdKey.SetStringValue("", launchCommand); err != nil {
-		fmt.Printf("Failed to set launch command: %s", err.Error())
-		return
+	return ""
+}
+
+// newDeviceId returns a random RFC 4122 version 4 UUID
+func newDeviceId() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
 	}
-	fmt.Printf("Successfully registered protocol: %s://\n", protocol)
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
 }
 
-// UnregisterProtocol removes a previously registered protocol from the system
-// protocol: The protocol name to unregister
-func UnregisterProtocol(protocol string) {
-	fmt.Printf("Unregistering protocol: %s\n", protocol)
-	if err := registry.DeleteKey(registry.CLASSES_ROOT, protocol); err != nil {
-		fmt.Printf("Failed to delete protocol registry keys: %s", err.Error())
-		return
+// getDeviceName derives a readable device name from the hostname
+func getDeviceName() string {
+	hostname, err := os.Hostname()
+	if err != nil || strings.TrimSpace(hostname) == "" {
+		return "PotPlayer"
 	}
-	fmt.Printf("Successfully unregistered protocol: %s://\n", protocol)
+	return fmt.Sprintf("PotPlayer (%s)", hostname)
 }
 
 // getStartTimeTicks returns the current time in ticks for playback start time
@@ -443,145 +255,200 @@ func printHelp() {
 	fmt.Println("Version: " + gVersion)
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  JellyPotBridge [command] [url]")
+	fmt.Println("  JellyPotBridge [flags] [command] [url]")
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  register          Register the jellypot:// protocol handler")
 	fmt.Println("  unregister        Unregister the jellypot:// protocol handler")
+	fmt.Println("  init              Create config.yaml with the setup wizard")
+	fmt.Println("  discover          Find Jellyfin servers on the local network")
+	fmt.Println("  detect-players    Find installed players")
+	fmt.Println("  doctor [item]     Check the setup and print a report to attach to an issue")
+	fmt.Println("  enqueue [url]     Queue an item on the running instance")
+	fmt.Println("  status            Show what the running instance is playing")
+	fmt.Println("  stop              Stop playback on the running instance")
 	fmt.Println("  help              Show this help message")
 	fmt.Println()
+	fmt.Println("Flags:")
+	fmt.Println("  --config [path]   Use this config file instead of config.yaml next to the program")
+	fmt.Println("  --profile [name]  Use this server profile instead of default-server")
+	fmt.Println("  --server [url]    Override the server URL of the profile")
+	fmt.Println("  --player [path]   Override pot-player-path")
+	fmt.Println()
+	fmt.Println("The config file is looked up in this order:")
+	for _, path := range configSearchPaths() {
+		fmt.Println("  " + path)
+	}
+	fmt.Println()
+	fmt.Println("Every flag can also be set as an environment variable, such as JELLYPOT_CONFIG, and every")
+	fmt.Println("config value as well, such as JELLYPOT_REPORTING_INTERVAL or JELLYPOT_JELLYFIN_PASSWORD.")
+	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  JellyPotBridge register")
 	fmt.Println("  JellyPotBridge jellypot://6b694a42d949478294df51e4ad9c5ef9")
+	fmt.Println("  JellyPotBridge jellypot://6b694a42d949478294df51e4ad9c5ef9?server=home")
+	fmt.Println("  JellyPotBridge enqueue jellypot://6b694a42d949478294df51e4ad9c5ef9")
 }
 
-// pressAnyKeyToContinue waits for the user to press any key before proceeding
-func pressAnyKeyToContinue() {
-	fmt.Print("Press any key to continue...")
-	fd := int(os.Stdin.Fd())
-	oldState, err := term.MakeRaw(fd)
-	if err != nil {
-		panic(err)
-	}
-	defer func(fd int, oldState *term.State) { _ = term.Restore(fd, oldState) }(fd, oldState)
-	b := make([]byte, 1)
-	_, _ = os.Stdin.Read(b)
-	fmt.Println()
-}
-
-// hideConsole hides the console window
-func hideConsole() {
-	if hWnd, _, _ := syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleWindow").Call(); hWnd != 0 {
-		_, _, _ = syscall.NewLazyDLL("user32.dll").NewProc("ShowWindow").Call(hWnd, 0)
+// parseItemUrl extracts the item ID and the optional server profile from a jellypot:// URL,
+// such as jellypot://6b694a42d949478294df51e4ad9c5ef9?server=home
+func parseItemUrl(arg string) (itemId, server string, ok bool) {
+	if !strings.HasPrefix(arg, "jellypot://") {
+		return "", "", false
 	}
-}
-
-const (
-	PipeName = `\\.\pipe\JellyPotBridge_39AC4C3F`
-)
-
-// EnsureSingleInstance ensures only one instance runs, with new instances replacing old ones
-func EnsureSingleInstance() bool {
-	if exists, err := notifyExistingInstance(); exists {
+	itemId = strings.TrimPrefix(arg, "jellypot://")
+	if i := strings.IndexByte(itemId, '?'); i >= 0 {
+		query, err := url.ParseQuery(itemId[i+1:])
 		if err != nil {
-			fmt.Printf("Warning: Failed to notify existing instance: %v\n", err)
+			return "", "", false
 		}
-		time.Sleep(500 * time.Millisecond)
-	}
-
-	pipe, err := createPipeServer()
-	if err != nil {
-		fmt.Printf("Failed to initialize: %v\n", err)
-		return false
+		itemId, server = itemId[:i], query.Get("server")
 	}
-	go listenForNewInstances(pipe)
-	return true
+	itemId = strings.TrimSuffix(itemId, "/")
+	return itemId, server, itemId != ""
 }
 
-// createPipeServer establishes a new named pipe server
-func createPipeServer() (windows.Handle, error) {
-	name, err := windows.UTF16PtrFromString(PipeName)
+// runInstanceCommand sends a command to the running instance and prints the result
+func runInstanceCommand(request InstanceRequest) error {
+	exists, response, err := notifyExistingInstance(request)
+	if !exists {
+		return errors.New("JellyPotBridge is not running")
+	}
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	return windows.CreateNamedPipe(
-		name,
-		windows.PIPE_ACCESS_DUPLEX,
-		windows.PIPE_TYPE_MESSAGE|windows.PIPE_READMODE_MESSAGE|windows.PIPE_WAIT,
-		1, 4096, 4096, 500, nil,
-	)
+	printStatus(response.Status)
+	return nil
 }
 
-// listenForNewInstances waits for new instances and exits when requested
-func listenForNewInstances(pipe windows.Handle) {
-	defer func(handle windows.Handle) { _ = windows.CloseHandle(handle) }(pipe)
-	buffer := make([]byte, 4096)
-	var bytesRead uint32
-
-	for {
-		// Wait for connection
-		if err := windows.ConnectNamedPipe(pipe, nil); err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
-			break
+// takeOverInstance stops the running instance and waits for it to exit
+func takeOverInstance() error {
+	if _, _, err := notifyExistingInstance(InstanceRequest{Command: InstanceCommandStop}); err != nil {
+		return err
+	}
+	for i := 0; i < 50; i++ {
+		if exists, _, _ := notifyExistingInstance(InstanceRequest{Command: InstanceCommandStatus}); !exists {
+			return nil
 		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return errors.New("timed out waiting for the running instance to exit")
+}
 
-		// Read message
-		if err := windows.ReadFile(pipe, buffer, &bytesRead, nil); err == nil || errors.Is(err, windows.ERROR_MORE_DATA) {
-			msg := windows.UTF16ToString((*[2048]uint16)(unsafe.Pointer(&buffer[0]))[:bytesRead/2])
-			if msg == "EXIT" {
-				_ = windows.DisconnectNamedPipe(pipe)
-				os.Exit(0)
-			}
+// printStatus prints the playback status reported by the running instance
+func printStatus(status *BridgeStatus) {
+	if status != nil && status.Server != "" {
+		fmt.Printf("Server: %s\n", status.Server)
+	}
+	if status == nil || status.ItemId == "" {
+		fmt.Println("Nothing is playing")
+	} else {
+		fmt.Printf("Playing: %s (%s)\n", status.Name, status.ItemId)
+		if status.State != "" {
+			fmt.Printf("State: %s\n", status.State)
 		}
-
-		_ = windows.DisconnectNamedPipe(pipe)
+		fmt.Printf("Position: %s / %s (%.1f%%)\n", formatTicks(status.PositionTicks),
+			formatTicks(status.RunTimeTicks), status.PercentWatched)
+	}
+	if status != nil && len(status.Queue) > 0 {
+		fmt.Printf("Queued: %s\n", strings.Join(status.Queue, ", "))
 	}
 }
 
-// notifyExistingInstance checks for running instance and sends exit command
-func notifyExistingInstance() (bool, error) {
-	// Try to connect to existing pipe
-	handle, err := windows.CreateFile(
-		windows.StringToUTF16Ptr(PipeName),
-		windows.GENERIC_READ|windows.GENERIC_WRITE,
-		0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0,
-	)
-
+// pressAnyKeyToContinue waits for the user to press any key before proceeding
+func pressAnyKeyToContinue() {
+	fmt.Print("Press any key to continue...")
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
 	if err != nil {
-		return false, nil // No existing instance
+		panic(err)
 	}
-	defer func(handle windows.Handle) { _ = windows.CloseHandle(handle) }(handle)
-
-	// Send exit command
-	msg := windows.StringToUTF16("EXIT")
-	var bytesWritten uint32
-	err = windows.WriteFile(
-		handle,
-		(*[1 << 16]byte)(unsafe.Pointer(&msg[0]))[:len(msg)*2],
-		&bytesWritten,
-		nil,
-	)
-
-	return true, err
+	defer func(fd int, oldState *term.State) { _ = term.Restore(fd, oldState) }(fd, oldState)
+	b := make([]byte, 1)
+	_, _ = os.Stdin.Read(b)
+	fmt.Println()
 }
 
 func main() {
-	var itemId string
-	if len(os.Args) > 1 {
-		arg := os.Args[1]
+	flags, err := parseFlags(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		printHelp()
+		os.Exit(1)
+	}
+	args := flags.Args()
+
+	var itemId, server string
+	if len(args) > 0 {
+		arg := args[0]
 		if arg == "help" {
 			printHelp()
 			return
 		} else if arg == "register" {
-			RegisterProtocol("jellypot", "jellypot protocol")
+			// Links opened from the browser keep using the config file given now
+			var launchArgs []string
+			if flags.Changed("config") {
+				path, _ := configFilePath()
+				launchArgs = append(launchArgs, "--config", path)
+			}
+			RegisterProtocol("jellypot", "jellypot protocol", launchArgs...)
 			return
 		} else if arg == "unregister" {
 			UnregisterProtocol("jellypot")
 			return
+		} else if arg == "init" {
+			if err := runSetupWizard(context.Background()); err != nil {
+				fmt.Printf("Setup failed: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		} else if arg == "doctor" {
+			if len(args) > 1 {
+				var ok bool
+				if itemId, server, ok = parseItemUrl(args[1]); !ok {
+					// A bare item ID as copied from the Jellyfin web client
+					itemId = args[1]
+				}
+			}
+			if err := runDoctor(context.Background(), itemId, server); err != nil {
+				os.Exit(1)
+			}
+			return
+		} else if arg == "detect-players" {
+			if err := runDetectPlayers(); err != nil {
+				fmt.Printf("Failed to detect players: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		} else if arg == "discover" {
+			if err := runDiscover(context.Background()); err != nil {
+				fmt.Printf("Failed to discover servers: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		} else if arg == InstanceCommandStatus || arg == InstanceCommandStop || arg == InstanceCommandEnqueue {
+			request := InstanceRequest{Command: arg}
+			if arg == InstanceCommandEnqueue {
+				var ok bool
+				if len(args) < 2 {
+					printHelp()
+					os.Exit(1)
+				} else if request.ItemId, request.Server, ok = parseItemUrl(args[1]); !ok {
+					printHelp()
+					os.Exit(1)
+				}
+				if request.Server == "" {
+					request.Server = viper.GetString("profile")
+				}
+			}
+			if err := runInstanceCommand(request); err != nil {
+				fmt.Printf("Failed to %s: %v\n", arg, err)
+				os.Exit(1)
+			}
+			return
 		} else {
-			if strings.HasPrefix(arg, "jellypot://") {
-				itemId = strings.TrimSuffix(strings.TrimPrefix(arg, "jellypot://"), "/")
-			} else {
+			var ok bool
+			if itemId, server, ok = parseItemUrl(arg); !ok {
 				printHelp()
 				pressAnyKeyToContinue()
 				os.Exit(1)
@@ -592,94 +459,138 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Hand playback to the running instance, which switches to the new item
+	// Without server= in the URL, the profile given by --profile or JELLYPOT_PROFILE has to match it
+	if server == "" {
+		server = viper.GetString("profile")
+	}
+	request := InstanceRequest{Command: InstanceCommandPlay, ItemId: itemId, Server: server}
+	if exists, response, err := notifyExistingInstance(request); exists {
+		if response != nil && response.OtherServer {
+			// The running instance is bound to another server, so replace it
+			fmt.Println("Running instance is connected to another server, stopping it")
+			if err := takeOverInstance(); err != nil {
+				fmt.Printf("Failed to stop the running instance: %v\n", err)
+				pressAnyKeyToContinue()
+				os.Exit(1)
+			}
+		} else if err != nil {
+			fmt.Printf("Running instance failed to play item: %v\n", err)
+			pressAnyKeyToContinue()
+			os.Exit(1)
+		} else {
+			fmt.Println("Playback handed over to the running instance")
+			return
+		}
+	}
+
+	// Ctrl+C and closing the console both end in a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The log is opened first so problems found while loading the configuration reach it as well;
+	// its level is applied once the configuration is loaded
+	if logPath, logFile, err := openLog(""); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		defer func(logFile io.Closer) { _ = logFile.Close() }(logFile)
+		fmt.Printf("Logging to %s\n", logPath)
+	}
+
 	// 1. Load configuration
-	config, err := loadConfig()
+	config, err := loadConfig(ctx, server)
 	if err != nil {
-		fmt.Printf("Failed to load configuration: %v\n", err)
-		pressAnyKeyToContinue()
-		os.Exit(1)
+		slog.Error("failed to load configuration", "error", err)
+		if !canRunWizard() || !promptYesNo("Run the setup wizard now?", true) {
+			pressAnyKeyToContinue()
+			os.Exit(1)
+		}
+		if err := runSetupWizard(ctx); err != nil {
+			slog.Error("setup failed", "error", err)
+			pressAnyKeyToContinue()
+			os.Exit(1)
+		}
+		if config, err = loadConfig(ctx, server); err != nil {
+			slog.Error("failed to load configuration", "error", err)
+			pressAnyKeyToContinue()
+			os.Exit(1)
+		}
 	}
 
+	setLogLevel(config.LogLevel)
+	slog.Info("starting", "version", gVersion, "item_id", itemId, "profile", config.profile)
+
 	// 2. Create JellyPot client and authenticate
 	jellyPotClient := NewJellyPotClient(config.Jellyfin.ServerUrl, config.Jellyfin.Username, config.Jellyfin.Password,
 		config.Jellyfin.DeviceId)
+	jellyPotClient.UseServerUrls(config.Jellyfin.urls())
+	jellyPotClient.UseTokenCache(config.DataPath("token.json"))
 
-	if err := jellyPotClient.Authenticate(); err != nil {
-		fmt.Printf("Jellyfin authentication failed: %v\n", err)
+	slog.Info("using server profile", "profile", config.profile, "server", jellyPotClient.ServerUrl())
+	if err := jellyPotClient.SelectServer(ctx); err != nil {
+		slog.Warn("failed to select a server URL", "error", err)
+	}
+	if err := jellyPotClient.Login(ctx); err != nil {
+		slog.Error("authentication failed", "status", statusCode(err), "error", err)
+		if errors.Is(err, ErrUnauthorized) {
+			fmt.Println("Check the username and password in the configuration file")
+		}
 		pressAnyKeyToContinue()
 		os.Exit(1)
 	}
-	fmt.Println("Jellyfin authentication successful")
+	slog.Info("logged in", "profile", config.profile, "server", jellyPotClient.ServerUrl())
 
 	// 3. Retrieve media item information
-	item, err := jellyPotClient.GetItem(itemId)
+	pending := NewProgressQueue(config.DataPath("progress-queue.json"))
+	if pending.Len() > 0 {
+		pending.Flush(ctx, jellyPotClient, "")
+	}
+	bridge := NewBridge(config, jellyPotClient, pending)
+	target, err := bridge.Resolve(ctx, itemId, -1)
 	if err != nil {
-		fmt.Printf("Failed to get media item information: %v\n", err)
+		slog.Error("failed to get media item", "item_id", itemId, "status", statusCode(err), "error", err)
 		pressAnyKeyToContinue()
 		os.Exit(1)
 	}
-	fmt.Printf("Successfully retrieved media info: %s (Type: %s)\n", item.Name, item.Type)
 
 	// 4. Launch PotPlayer
-	if !EnsureSingleInstance() {
-		fmt.Println("Failed to start - another instance is running")
+	if !EnsureSingleInstance(ctx, bridge) {
 		pressAnyKeyToContinue()
 		os.Exit(1)
 	}
-	playbackUrl := fmt.Sprintf("%s/Items/%s/Download?api_key=%s", config.Jellyfin.ServerUrl, itemId,
-		jellyPotClient.accessToken)
-	fmt.Printf("Starting playback: %s\n", playbackUrl)
-
-	cmd := exec.Command(config.PotPlayerPath,
-		playbackUrl,
-		"/title="+item.Name,
-		"/seek="+strconv.FormatInt(item.UserData.PlaybackPositionTicks/TicksPerMillisecond/1000, 10),
-		"/current",
-	)
-	if err := cmd.Start(); err != nil {
-		fmt.Printf("Failed to start PotPlayer: %v\n", err)
+	if err := bridge.Start(ctx, target); err != nil {
 		pressAnyKeyToContinue()
 		os.Exit(1)
 	}
 
-	// 5. Monitor PotPlayer and send status updates at intervals
-	time.Sleep(3 * time.Second) // Wait for PotPlayer to initialize
-	ticker := time.NewTicker(config.ReportingInterval)
-	defer ticker.Stop()
-
-	potPlayerPid := cmd.Process.Pid
-	fmt.Printf("PotPlayer started with PID: %d, reporting interval: %v\n",
-		potPlayerPid, config.ReportingInterval)
-
-	hideConsole()
-	startTimeTicks := getStartTimeTicks()
-
-	for {
-		select {
-		case <-ticker.C:
-			info, err := getPotPlayerInfo()
-			if err != nil {
-				fmt.Println("PotPlayer has exited")
-				os.Exit(0)
-			}
-
-			event := PlaybackStatusEvent{
-				PositionTicks:          info.Ticks,
-				PlaybackStartTimeTicks: startTimeTicks,
-				PlayMethod:             "DirectPlay",
-				MediaSourceId:          itemId,
-				CanSeek:                true,
-				ItemId:                 itemId,
-				EventName:              info.EventName,
-			}
-			if event.PositionTicks > TicksPerMillisecond*60000 {
-				if err := jellyPotClient.UpdatePlaybackStatus(event); err != nil {
-					fmt.Printf("Failed to send status update: %v\n", err)
-				} else {
-					fmt.Printf("Status updated: %s, Position: %d ticks\n",
-						event.EventName, event.PositionTicks)
-				}
-			}
+	// 5. Accept remote control from the Jellyfin session
+	if err := jellyPotClient.PostCapabilities(ctx, ClientCapabilities{
+		PlayableMediaTypes:           []string{"Video", "Audio"},
+		SupportedCommands:            SupportedGeneralCommands,
+		SupportsMediaControl:         true,
+		SupportsPersistentIdentifier: true,
+	}); err != nil {
+		slog.Warn("failed to post client capabilities", "status", statusCode(err), "error", err)
+	}
+	go NewRemoteSession(jellyPotClient, bridge).Run(ctx)
+	watchConfig(config, bridge)
+	if config.StatusAddress != "" {
+		if err := StartStatusServer(ctx, config.StatusAddress, bridge); err != nil {
+			slog.Warn("failed to start status server", "error", err)
+		} else {
+			slog.Info("serving status", "url", "http://"+config.StatusAddress+"/status")
+		}
+	}
+	if config.MetricsAddress != "" {
+		if err := StartMetricsServer(ctx, config.MetricsAddress, bridge); err != nil {
+			slog.Warn("failed to start metrics server", "error", err)
+		} else {
+			slog.Info("serving metrics", "url", "http://"+config.MetricsAddress+"/metrics")
 		}
 	}
+
+	// 6. Monitor PotPlayer and send status updates at intervals
+	hideConsole()
+	bridge.Monitor(ctx)
+	waitForInstanceRequest()
 }
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PlaybackTarget describes a Jellyfin item resolved and ready to be played
+type PlaybackTarget struct {
+	Item           *MediaItem
+	MediaSource    *MediaSourceInfo // Nil when the playback info could not be retrieved
+	MediaSourceId  string
+	PlaySessionId  string
+	StartTicks     int64
+	StartTimeTicks int64
+	PositionTicks  int64
+	PlayerRunTime  int64 // Duration reported by the player in ticks
+	warnedRunTime  bool
+}
+
+// Completion thresholds, matching Jellyfin's default resume settings
+const (
+	CompletedPercent       = 90.0
+	RunTimeMismatchPercent = 5.0
+)
+
+// RunTimeTicks returns the best known duration, preferring the player over Jellyfin
+func (t *PlaybackTarget) RunTimeTicks() int64 {
+	if t.PlayerRunTime > 0 {
+		return t.PlayerRunTime
+	}
+	return t.Item.RunTimeTicks
+}
+
+// PercentWatched returns the current position as a percentage of the duration, or 0 when unknown
+func (t *PlaybackTarget) PercentWatched() float64 {
+	runTime := t.RunTimeTicks()
+	if runTime <= 0 {
+		return 0
+	}
+	return min(float64(t.PositionTicks)*100/float64(runTime), 100)
+}
+
+// Completed reports whether enough has been watched for Jellyfin to mark the item played
+func (t *PlaybackTarget) Completed() bool {
+	return t.PercentWatched() >= CompletedPercent
+}
+
+// RunTimeMismatch reports whether the player and Jellyfin disagree on the duration,
+// which usually means the player opened a different file than expected
+func (t *PlaybackTarget) RunTimeMismatch() bool {
+	if t.PlayerRunTime <= 0 || t.Item.RunTimeTicks <= 0 {
+		return false
+	}
+	diff := float64(t.PlayerRunTime - t.Item.RunTimeTicks)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff*100/float64(t.Item.RunTimeTicks) > RunTimeMismatchPercent
+}
+
+// Bridge ties the player launched by this instance to the Jellyfin session
+type Bridge struct {
+	config  *JellyPotConfig
+	client  *JellyPotClient
+	player  *PotPlayer
+	pending *ProgressQueue
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	current *PlaybackTarget
+	queue   []string
+	state   string        // Playback state of the current target, see PlaybackState constants
+	report  *ReportResult // Outcome of the last playback report
+
+	// Snapshot for Status, which must answer while b.mu is held across calls to Jellyfin
+	statusMu sync.Mutex
+	status   BridgeStatus
+
+	quit         chan struct{}
+	quitOnce     sync.Once
+	reconfigured chan struct{} // Signals Monitor that the reporting interval changed
+}
+
+// NewBridge creates a new Bridge for the given configuration, client and offline progress queue
+func NewBridge(config *JellyPotConfig, client *JellyPotClient, pending *ProgressQueue) *Bridge {
+	b := &Bridge{
+		config:  config,
+		client:  client,
+		player:  NewPotPlayer(),
+		pending: pending,
+		quit:    make(chan struct{}),
+
+		reconfigured: make(chan struct{}, 1),
+	}
+	b.publishLocked()
+	return b
+}
+
+// ApplyConfig takes over the settings of a reloaded configuration that can change while running:
+// the reporting interval and the player preferences
+func (b *Bridge) ApplyConfig(config *JellyPotConfig) {
+	b.mu.Lock()
+	defer b.unlock()
+	if config.ReportingInterval != b.config.ReportingInterval {
+		slog.Info("reloaded setting", "key", "reporting-interval", "value", config.ReportingInterval)
+		b.config.ReportingInterval = config.ReportingInterval
+		select {
+		case b.reconfigured <- struct{}{}:
+		default:
+		}
+	}
+	if config.PotPlayerPath != b.config.PotPlayerPath {
+		slog.Info("reloaded setting", "key", "pot-player-path", "value", config.PotPlayerPath)
+		b.config.PotPlayerPath = config.PotPlayerPath
+	}
+	if config.LogLevel != b.config.LogLevel {
+		slog.Info("reloaded setting", "key", "log-level", "value", config.LogLevel)
+		b.config.LogLevel = config.LogLevel
+		setLogLevel(config.LogLevel)
+	}
+	if config.ClosePlayerOnExit != b.config.ClosePlayerOnExit {
+		slog.Info("reloaded setting", "key", "close-player-on-exit", "value", config.ClosePlayerOnExit)
+		b.config.ClosePlayerOnExit = config.ClosePlayerOnExit
+	}
+	if !slices.Equal(config.LaunchArgs, b.config.LaunchArgs) {
+		slog.Info("reloaded setting", "key", "launch-args", "value", config.launchArgs())
+		b.config.LaunchArgs = config.LaunchArgs
+	}
+}
+
+// settings returns the reporting interval and close-player-on-exit, which ApplyConfig may change
+func (b *Bridge) settings() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.unlock()
+	return b.config.ReportingInterval, b.config.ClosePlayerOnExit
+}
+
+// Resolve retrieves an item and its playback info from Jellyfin
+// startTicks: Position to start from, or a negative value to resume from the saved position
+func (b *Bridge) Resolve(ctx context.Context, itemId string, startTicks int64) (*PlaybackTarget, error) {
+	item, err := b.client.GetItem(ctx, itemId)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("retrieved media item", "item_id", item.Id, "title", item.Name, "type", item.Type)
+
+	target := &PlaybackTarget{
+		Item:          item,
+		MediaSourceId: item.Id,
+		StartTicks:    startTicks,
+	}
+	if target.StartTicks < 0 {
+		target.StartTicks = item.UserData.PlaybackPositionTicks
+	}
+
+	if playbackInfo, err := b.client.GetPlaybackInfo(ctx, item.Id); err != nil {
+		slog.Warn("failed to get playback info", "item_id", item.Id, "status", statusCode(err), "error", err)
+	} else {
+		target.PlaySessionId = playbackInfo.PlaySessionId
+		if len(playbackInfo.MediaSources) > 0 {
+			target.MediaSource = &playbackInfo.MediaSources[0]
+			target.MediaSourceId = target.MediaSource.Id
+		}
+	}
+	return target, nil
+}
+
+// Start launches the player for a resolved target, replacing whatever is playing
+func (b *Bridge) Start(ctx context.Context, target *PlaybackTarget) error {
+	b.mu.Lock()
+	defer b.unlock()
+	return b.startLocked(ctx, target)
+}
+
+// Play resolves an item and starts playing it
+func (b *Bridge) Play(ctx context.Context, itemId string, startTicks int64) error {
+	b.mu.Lock()
+	defer b.unlock()
+	return b.playLocked(ctx, itemId, startTicks)
+}
+
+// playLocked resolves an item and starts playing it; b.mu must be held
+func (b *Bridge) playLocked(ctx context.Context, itemId string, startTicks int64) error {
+	target, err := b.Resolve(ctx, itemId, startTicks)
+	if err != nil {
+		return err
+	}
+	return b.startLocked(ctx, target)
+}
+
+// Enqueue adds items to play after the current one
+func (b *Bridge) Enqueue(itemIds ...string) {
+	b.mu.Lock()
+	defer b.unlock()
+	b.queue = append(b.queue, itemIds...)
+}
+
+// Stop reports the current item as stopped and shuts the bridge down, closing PotPlayer when
+// close-player-on-exit is set
+func (b *Bridge) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	b.finishLocked(ctx)
+	closePlayer := b.config.ClosePlayerOnExit
+	b.unlock()
+	defer b.Quit()
+	if !closePlayer {
+		return nil
+	}
+	return b.player.Close()
+}
+
+// stopPlayback closes the media in PotPlayer and reports the stop, keeping PotPlayer and the remote
+// control session open so the bridge can still be cast to
+func (b *Bridge) stopPlayback(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.unlock()
+	b.finishLocked(ctx)
+	return b.player.Stop()
+}
+
+// finishLocked reports the current item as stopped at the position PotPlayer is at and clears the queue;
+// b.mu must be held
+func (b *Bridge) finishLocked(ctx context.Context) {
+	if b.current != nil {
+		if info, err := b.player.Info(); err == nil && info.Status != -1 {
+			b.current.PositionTicks = info.Ticks
+		}
+		b.reportStoppedLocked(ctx)
+	}
+	b.queue = nil
+}
+
+// Playback states reported by BridgeStatus
+const (
+	PlaybackStateIdle    = "idle"
+	PlaybackStatePlaying = "playing"
+	PlaybackStatePaused  = "paused"
+	PlaybackStateStopped = "stopped" // Media closed in PotPlayer before it was finished
+)
+
+// BridgeStatus describes what the bridge is currently playing
+type BridgeStatus struct {
+	Server         string        `json:"server,omitempty"`
+	ItemId         string        `json:"itemId,omitempty"`
+	Name           string        `json:"name,omitempty"`
+	State          string        `json:"state,omitempty"`
+	PositionTicks  int64         `json:"positionTicks"`
+	RunTimeTicks   int64         `json:"runTimeTicks"`
+	PercentWatched float64       `json:"percentWatched"`
+	Queue          []string      `json:"queue"`
+	Player         string        `json:"player,omitempty"`
+	LastReport     *ReportResult `json:"lastReport,omitempty"`
+}
+
+// ReportResult is the outcome of a playback report sent to Jellyfin
+type ReportResult struct {
+	Time       time.Time `json:"time"`
+	ItemId     string    `json:"itemId"`
+	Event      string    `json:"event"`
+	Ok         bool      `json:"ok"`
+	StatusCode int       `json:"statusCode,omitempty"` // HTTP status of a rejected report
+	Error      string    `json:"error,omitempty"`
+}
+
+// recordReportLocked keeps the outcome of a playback report for Status; b.mu must be held
+func (b *Bridge) recordReportLocked(event PlaybackStatusEvent, err error) {
+	result := &ReportResult{Time: time.Now(), ItemId: event.ItemId, Event: event.EventName, Ok: err == nil}
+	if result.Event == "" {
+		result.Event = "start"
+	}
+	metrics.RecordReport(result.Event, err)
+	if err != nil {
+		result.Error = err.Error()
+		result.StatusCode = statusCode(err)
+	}
+	b.report = result
+}
+
+// logReportFailure logs a failed playback report with its item, event and the HTTP status Jellyfin answered with
+func logReportFailure(msg string, result *ReportResult, queued bool) {
+	slog.Error(msg, "item_id", result.ItemId, "event", result.Event, "status", result.StatusCode, "queued", queued,
+		"error", result.Error)
+}
+
+// Status returns a snapshot of the current playback
+// It does not wait for b.mu, so it answers even while a report to an unreachable server is being retried
+func (b *Bridge) Status() BridgeStatus {
+	b.statusMu.Lock()
+	defer b.statusMu.Unlock()
+	return b.status
+}
+
+// unlock publishes the status snapshot and releases b.mu
+func (b *Bridge) unlock() {
+	b.publishLocked()
+	b.mu.Unlock()
+}
+
+// publishLocked updates the snapshot returned by Status; b.mu must be held
+func (b *Bridge) publishLocked() {
+	status := BridgeStatus{
+		Server:     b.config.profile,
+		State:      PlaybackStateIdle,
+		Queue:      append([]string{}, b.queue...),
+		Player:     b.config.PotPlayerPath,
+		LastReport: b.report,
+	}
+	if b.current != nil {
+		status.ItemId = b.current.Item.Id
+		status.Name = b.current.Item.Name
+		status.State = b.state
+		status.PositionTicks = b.current.PositionTicks
+		status.RunTimeTicks = b.current.RunTimeTicks()
+		status.PercentWatched = b.current.PercentWatched()
+	}
+	b.statusMu.Lock()
+	b.status = status
+	b.statusMu.Unlock()
+}
+
+// startLocked launches the player and reports the start; b.mu must be held
+func (b *Bridge) startLocked(ctx context.Context, target *PlaybackTarget) error {
+	if b.current != nil {
+		b.reportStoppedLocked(ctx)
+	}
+
+	values := b.launchValues(target)
+	cmd := exec.Command(b.config.PotPlayerPath, expandLaunchArgs(b.config.launchArgs(), values)...)
+	if err := cmd.Start(); err != nil {
+		slog.Error("failed to start player", "item_id", target.Item.Id, "player", b.config.PotPlayerPath,
+			"error", err)
+		return err
+	}
+	slog.Info("playback started", "item_id", target.Item.Id, "title", target.Item.Name,
+		"start_ticks", target.StartTicks, "pid", cmd.Process.Pid)
+	go func() { _ = cmd.Wait() }()
+
+	b.cmd = cmd
+	b.current = target
+	target.StartTimeTicks = getStartTimeTicks()
+	target.PositionTicks = target.StartTicks
+	b.state = PlaybackStatePlaying
+	b.publishLocked()
+
+	event := b.eventLocked("")
+	err := b.client.ReportPlaybackStart(ctx, event)
+	b.recordReportLocked(event, err)
+	if err != nil {
+		logReportFailure("failed to report playback start", b.report, false)
+	}
+	return nil
+}
+
+// eventLocked builds a playback event for the current target; b.mu must be held
+func (b *Bridge) eventLocked(eventName string) PlaybackStatusEvent {
+	return PlaybackStatusEvent{
+		PositionTicks:          b.current.PositionTicks,
+		PlaybackStartTimeTicks: b.current.StartTimeTicks,
+		PlayMethod:             "DirectPlay",
+		MediaSourceId:          b.current.MediaSourceId,
+		CanSeek:                true,
+		ItemId:                 b.current.Item.Id,
+		EventName:              eventName,
+		PlaySessionId:          b.current.PlaySessionId,
+	}
+}
+
+// reportStoppedLocked tells Jellyfin the current target has stopped; b.mu must be held
+func (b *Bridge) reportStoppedLocked(ctx context.Context) {
+	event := b.eventLocked("stop")
+	err := b.client.ReportPlaybackStopped(ctx, event)
+	b.recordReportLocked(event, err)
+	if err != nil {
+		logReportFailure("failed to report playback stop", b.report, isTransient(err))
+		if isTransient(err) {
+			b.pending.Put(event)
+		}
+	} else {
+		b.pending.Remove(event.ItemId)
+		slog.Info("playback stopped", "item_id", event.ItemId, "position_ticks", event.PositionTicks)
+	}
+	b.current = nil
+}
+
+// Monitor polls PotPlayer and sends status updates at the configured interval
+// It returns after the final report once PotPlayer exits, Quit is called or ctx is cancelled
+func (b *Bridge) Monitor(ctx context.Context) {
+	b.mu.Lock()
+	slog.Info("monitoring player", "pid", b.cmd.Process.Pid, "interval", b.config.ReportingInterval)
+	b.unlock()
+
+	// Wait for PotPlayer to initialize
+	select {
+	case <-time.After(3 * time.Second):
+	case <-ctx.Done():
+		_, closePlayer := b.settings()
+		b.shutdown(closePlayer)
+		return
+	case <-b.quit:
+		b.shutdown(false)
+		return
+	}
+
+	interval, _ := b.settings()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("shutting down")
+			_, closePlayer := b.settings()
+			b.shutdown(closePlayer)
+			return
+		case <-b.reconfigured:
+			interval, _ := b.settings()
+			ticker.Reset(interval)
+		case <-b.quit:
+			b.shutdown(false)
+			return
+		case <-ticker.C:
+			started := time.Now()
+			info, err := b.player.Info()
+			metrics.RecordPoll(time.Since(started))
+			if err != nil {
+				slog.Info("player exited")
+				b.shutdown(false)
+				return
+			}
+			b.update(ctx, info)
+			b.flushPending(ctx)
+		}
+	}
+}
+
+// flushPending sends the positions queued while Jellyfin was unreachable, so they arrive once it is back
+// even when nothing is playing; the item still playing is left to its own reports
+func (b *Bridge) flushPending(ctx context.Context) {
+	b.mu.Lock()
+	defer b.unlock()
+	if b.pending.Len() == 0 {
+		return
+	}
+	playing := ""
+	if b.current != nil && b.state != PlaybackStateStopped {
+		playing = b.current.Item.Id
+	}
+	b.pending.Flush(ctx, b.client, playing)
+}
+
+// Quit makes Monitor send its final report and return
+func (b *Bridge) Quit() {
+	b.quitOnce.Do(func() { close(b.quit) })
+}
+
+// shutdown sends the final stop report and optionally closes the player this instance launched
+func (b *Bridge) shutdown(closePlayer bool) {
+	// The monitor context may already be cancelled, so the final report gets its own deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b.mu.Lock()
+	defer b.unlock()
+	b.finishLocked(ctx)
+
+	if closePlayer {
+		if err := b.player.Close(); err != nil {
+			slog.Warn("failed to close player", "error", err)
+		}
+	}
+}
+
+// update reports the latest PotPlayer state for the current target
+func (b *Bridge) update(ctx context.Context, info *PotPlayerInfo) {
+	b.mu.Lock()
+	defer b.unlock()
+	if b.current == nil {
+		return
+	}
+
+	if info.Status == -1 {
+		// Media was closed in PotPlayer; a finished item gets its final report so Jellyfin marks it played
+		if b.current.Completed() {
+			slog.Info("playback completed", "item_id", b.current.Item.Id)
+			b.reportStoppedLocked(ctx)
+			b.playNextLocked(ctx)
+			return
+		}
+		// The item is kept so reopening it in PotPlayer resumes the reports
+		b.state = PlaybackStateStopped
+		return
+	}
+
+	b.current.PositionTicks = info.Ticks
+	switch info.EventName {
+	case "timeupdate":
+		b.state = PlaybackStatePlaying
+	case "pause":
+		b.state = PlaybackStatePaused
+	}
+	if info.RunTimeTicks > 0 {
+		b.current.PlayerRunTime = info.RunTimeTicks
+	}
+	if !b.current.warnedRunTime && b.current.RunTimeMismatch() {
+		b.current.warnedRunTime = true
+		slog.Warn("player duration differs from the Jellyfin runtime", "item_id", b.current.Item.Id,
+			"player_runtime", formatTicks(b.current.PlayerRunTime),
+			"jellyfin_runtime", formatTicks(b.current.Item.RunTimeTicks))
+	}
+
+	b.publishLocked()
+
+	event := b.eventLocked(info.EventName)
+	if event.PositionTicks > TicksPerMillisecond*60000 {
+		err := b.client.UpdatePlaybackStatus(ctx, event)
+		b.recordReportLocked(event, err)
+		if err != nil {
+			logReportFailure("failed to send status update", b.report, isTransient(err))
+			if isTransient(err) {
+				// Keep the position so the resume point survives until the server is back
+				b.pending.Put(event)
+			}
+		} else {
+			b.pending.Remove(event.ItemId)
+			slog.Debug("status updated", "item_id", event.ItemId, "event", event.EventName,
+				"position", formatTicks(event.PositionTicks), "runtime", formatTicks(b.current.RunTimeTicks()),
+				"percent", fmt.Sprintf("%.1f", b.current.PercentWatched()))
+		}
+	}
+}
+
+// formatTicks formats a tick count as a clock time
+func formatTicks(ticks int64) string {
+	return (time.Duration(ticks) * 100).Truncate(time.Second).String()
+}
+
+// HandlePlaystate applies a Playstate command received from the Jellyfin session
+func (b *Bridge) HandlePlaystate(ctx context.Context, request PlaystateRequest) error {
+	switch request.Command {
+	case "Pause":
+		return b.player.Pause()
+	case "Unpause":
+		return b.player.Resume()
+	case "PlayPause":
+		return b.player.TogglePause()
+	case "Seek":
+		return b.player.SeekTo(request.SeekPositionTicks)
+	case "Stop":
+		return b.stopPlayback(ctx)
+	case "NextTrack":
+		return b.next(ctx)
+	case "PreviousTrack":
+		return b.player.Previous()
+	default:
+		return fmt.Errorf("unsupported playstate command: %s", request.Command)
+	}
+}
+
+// HandlePlay applies a Play command received from the Jellyfin session
+func (b *Bridge) HandlePlay(ctx context.Context, request PlayRequest) error {
+	if len(request.ItemIds) == 0 {
+		return errors.New("play command contains no items")
+	}
+
+	b.mu.Lock()
+	switch request.PlayCommand {
+	case "PlayNext":
+		b.queue = append(append([]string{}, request.ItemIds...), b.queue...)
+		b.unlock()
+		return nil
+	case "PlayLast":
+		b.unlock()
+		b.Enqueue(request.ItemIds...)
+		return nil
+	}
+
+	start := request.StartIndex
+	if start < 0 || start >= len(request.ItemIds) {
+		start = 0
+	}
+	b.queue = append([]string{}, request.ItemIds[start+1:]...)
+	b.unlock()
+
+	startTicks := int64(-1)
+	if request.StartPositionTicks > 0 {
+		startTicks = request.StartPositionTicks
+	}
+	return b.Play(ctx, request.ItemIds[start], startTicks)
+}
+
+// HandleGeneralCommand applies a general command received from the Jellyfin session
+func (b *Bridge) HandleGeneralCommand(ctx context.Context, request GeneralCommandRequest) error {
+	switch request.Name {
+	case "SetVolume":
+		volume, err := strconv.Atoi(request.Arguments["Volume"])
+		if err != nil {
+			return fmt.Errorf("invalid volume: %w", err)
+		}
+		return b.player.SetVolume(volume)
+	case "VolumeUp", "VolumeDown":
+		volume, err := b.player.Volume()
+		if err != nil {
+			return err
+		}
+		if request.Name == "VolumeUp" {
+			return b.player.SetVolume(volume + 5)
+		}
+		return b.player.SetVolume(volume - 5)
+	default:
+		return fmt.Errorf("unsupported general command: %s", request.Name)
+	}
+}
+
+// HandleInstanceRequest applies a request received from another launch of the bridge
+func (b *Bridge) HandleInstanceRequest(ctx context.Context, request InstanceRequest) InstanceResponse {
+	if (request.Command == InstanceCommandPlay || request.Command == InstanceCommandEnqueue) &&
+		!b.config.matchesProfile(request.Server) {
+		// Items of another server cannot be resolved with this session
+		return InstanceResponse{
+			Error:       fmt.Sprintf("connected to server profile %s", b.config.profile),
+			OtherServer: true,
+		}
+	}
+
+	var err error
+	switch request.Command {
+	case InstanceCommandPlay:
+		if request.ItemId == "" {
+			err = errors.New("play requires an item ID")
+		} else {
+			err = b.Play(ctx, request.ItemId, -1)
+		}
+	case InstanceCommandEnqueue:
+		if request.ItemId == "" {
+			err = errors.New("enqueue requires an item ID")
+		} else {
+			b.Enqueue(request.ItemId)
+		}
+	case InstanceCommandStatus:
+	case InstanceCommandStop:
+		err = b.Stop(ctx)
+	default:
+		err = fmt.Errorf("unknown command: %s", request.Command)
+	}
+
+	if err != nil {
+		return InstanceResponse{Error: err.Error()}
+	}
+	status := b.Status()
+	return InstanceResponse{Ok: true, Status: &status}
+}
+
+// next plays the next queued item, or asks PotPlayer to skip within its own playlist
+func (b *Bridge) next(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.unlock()
+	if len(b.queue) == 0 {
+		return b.player.Next()
+	}
+	return b.playNextLocked(ctx)
+}
+
+// playNextLocked starts the next queued item, if any; b.mu must be held
+func (b *Bridge) playNextLocked(ctx context.Context) error {
+	if len(b.queue) == 0 {
+		return nil
+	}
+	itemId := b.queue[0]
+	b.queue = b.queue[1:]
+	if err := b.playLocked(ctx, itemId, -1); err != nil {
+		slog.Error("failed to play next item", "item_id", itemId, "status", statusCode(err), "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Jellyfin answers this UDP broadcast with a JSON description of itself
+const (
+	DiscoveryPort    = 7359
+	DiscoveryMessage = "who is JellyfinServer?"
+	DiscoveryTimeout = 3 * time.Second
+)
+
+// DiscoveredServer is a Jellyfin server that answered the discovery broadcast
+type DiscoveredServer struct {
+	Id      string `json:"Id"`
+	Name    string `json:"Name"`
+	Address string `json:"Address"`
+}
+
+// DiscoverServers broadcasts the Jellyfin discovery message and collects the answers until timeout
+func DiscoverServers(ctx context.Context, timeout time.Duration) ([]DiscoveredServer, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer func(conn net.PacketConn) { _ = conn.Close() }(conn)
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Unblock ReadFrom when ctx is cancelled
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	var sent int
+	for _, addr := range broadcastAddresses() {
+		if _, err := conn.WriteTo([]byte(DiscoveryMessage), &net.UDPAddr{IP: addr, Port: DiscoveryPort}); err == nil {
+			sent++
+		}
+	}
+	if sent == 0 {
+		return nil, errors.New("failed to send discovery broadcast")
+	}
+
+	var servers []DiscoveredServer
+	seen := make(map[string]bool)
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return servers, fmt.Errorf("failed to read discovery reply: %w", err)
+		}
+		var server DiscoveredServer
+		if err := json.Unmarshal(buf[:n], &server); err != nil || server.Address == "" {
+			continue
+		}
+		// Every interface may carry the same answer
+		if key := server.Id + "|" + server.Address; !seen[key] {
+			seen[key] = true
+			servers = append(servers, server)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return servers, err
+	}
+	return servers, nil
+}
+
+// broadcastAddresses returns the limited broadcast address and the directed one of every IPv4 network
+func broadcastAddresses() []net.IP {
+	addrs := []net.IP{net.IPv4bcast}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return addrs
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || len(ipNet.Mask) != net.IPv4len {
+				continue
+			}
+			ip := ipNet.IP.To4()
+			broadcast := make(net.IP, net.IPv4len)
+			for i := range broadcast {
+				broadcast[i] = ip[i] | ^ipNet.Mask[i]
+			}
+			addrs = append(addrs, broadcast)
+		}
+	}
+	return addrs
+}
+
+// printDiscoveredServers lists discovered servers with a number to choose them by
+func printDiscoveredServers(servers []DiscoveredServer) {
+	fmt.Printf("Found %d Jellyfin server(s):\n", len(servers))
+	for i, server := range servers {
+		fmt.Printf("  %d. %s - %s (ID %s)\n", i+1, server.Name, server.Address, server.Id)
+	}
+}
+
+// chooseDiscoveredServer asks which of the listed servers to use, returning nil when none is chosen
+func chooseDiscoveredServer(servers []DiscoveredServer) *DiscoveredServer {
+	if len(servers) == 0 {
+		return nil
+	}
+	for {
+		line := promptLine(fmt.Sprintf("Choose a server (1-%d), or press Enter to skip", len(servers)), "")
+		if line == "" {
+			return nil
+		}
+		if i, err := strconv.Atoi(line); err == nil && i >= 1 && i <= len(servers) {
+			return &servers[i-1]
+		}
+		fmt.Println("Invalid choice")
+	}
+}
+
+// discoverServerUrl runs discovery on the console and returns the address of the chosen server
+func discoverServerUrl(ctx context.Context) (string, error) {
+	fmt.Println("Searching for Jellyfin servers on the local network...")
+	servers, err := DiscoverServers(ctx, DiscoveryTimeout)
+	if err != nil {
+		return "", err
+	}
+	if len(servers) == 0 {
+		return "", errors.New("no Jellyfin server answered")
+	}
+	printDiscoveredServers(servers)
+	server := chooseDiscoveredServer(servers)
+	if server == nil {
+		return "", errors.New("no server chosen")
+	}
+	return server.Address, nil
+}
+
+// runDiscover lists the servers on the local network and prints where to configure the chosen one
+func runDiscover(ctx context.Context) error {
+	address, err := discoverServerUrl(ctx)
+	if err != nil {
+		return err
+	}
+	config, err := readConfig()
+	if err != nil {
+		fmt.Printf("Set server-url to %s in config.yaml\n", address)
+		return err
+	}
+	printConfigHint(config.serverUrlKey(), address)
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Outcomes of a doctor check
+const (
+	CheckPass = "PASS"
+	CheckFail = "FAIL"
+	CheckSkip = "SKIP"
+)
+
+// doctorReport collects the outcome of every doctor check
+type doctorReport struct {
+	failed bool
+}
+
+// add prints the outcome of a check, with one indented line per detail
+func (r *doctorReport) add(status, name, message string, details ...string) {
+	if status == CheckFail {
+		r.failed = true
+	}
+	fmt.Printf("[%s] %s: %s\n", status, name, message)
+	for _, detail := range details {
+		fmt.Printf("       %s\n", detail)
+	}
+}
+
+// runDoctor checks the configuration, the server, the login, the protocol registration and the player,
+// and resolves the playback of itemId when it is not empty
+// The report leaves out passwords and tokens so it can be pasted into an issue
+func runDoctor(ctx context.Context, itemId, server string) error {
+	report := &doctorReport{}
+	fmt.Printf("JellyPotBridge %s doctor (%s/%s)\n", gVersion, runtime.GOOS, runtime.GOARCH)
+	fmt.Println()
+
+	config := doctorConfig(report, server)
+	doctorProtocol(report)
+	if config != nil {
+		doctorPlayer(report, config)
+		if client := doctorServer(ctx, report, config); client != nil {
+			doctorPlayback(ctx, report, config, client, itemId)
+		}
+	}
+
+	fmt.Println()
+	if report.failed {
+		fmt.Println("Some checks failed")
+		return errors.New("some checks failed")
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+// doctorConfig reads, selects and validates the configuration without changing the config file
+func doctorConfig(report *doctorReport, server string) *JellyPotConfig {
+	config, err := readConfig()
+	if err != nil {
+		report.add(CheckFail, "Config", err.Error())
+		return nil
+	}
+	if _, err := config.setupProfile(server); err != nil {
+		report.add(CheckFail, "Config", viper.ConfigFileUsed(), err.Error())
+		return nil
+	}
+
+	var problems *ConfigError
+	if err := config.Validate(); errors.As(err, &problems) {
+		var details []string
+		for _, problem := range problems.Problems {
+			details = append(details, fmt.Sprintf("%s: %s", problem.Key, problem.Message))
+		}
+		report.add(CheckFail, "Config", viper.ConfigFileUsed(), details...)
+	} else if err != nil {
+		report.add(CheckFail, "Config", viper.ConfigFileUsed(), err.Error())
+	} else {
+		report.add(CheckPass, "Config", viper.ConfigFileUsed(), "profile "+config.profile)
+	}
+	return config
+}
+
+// doctorProtocol checks that jellypot:// links start this executable
+func doctorProtocol(report *doctorReport) {
+	command, err := ProtocolCommand("jellypot")
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		report.add(CheckSkip, "Protocol", "registration is only supported on Windows")
+		return
+	case err != nil:
+		report.add(CheckFail, "Protocol", "jellypot:// is not registered, run JellyPotBridge.exe register")
+		return
+	}
+	exePath, err := os.Executable()
+	if err == nil {
+		exePath, err = filepath.Abs(exePath)
+	}
+	if err != nil || !strings.Contains(strings.ToLower(command), strings.ToLower(exePath)) {
+		report.add(CheckFail, "Protocol", "jellypot:// starts another program, run JellyPotBridge.exe register again",
+			command)
+		return
+	}
+	report.add(CheckPass, "Protocol", command)
+}
+
+// doctorPlayer checks the player path the bridge would launch
+func doctorPlayer(report *doctorReport, config *JellyPotConfig) {
+	if err := checkExecutable(config.PotPlayerPath); err != nil {
+		report.add(CheckFail, "Player", fmt.Sprintf("pot-player-path %v", err))
+		return
+	}
+	report.add(CheckPass, "Player", config.PotPlayerPath, fmt.Sprintf("launch-args %q", config.launchArgs()))
+}
+
+// doctorServer probes every server address and logs in, returning the client when the login works
+func doctorServer(ctx context.Context, report *doctorReport, config *JellyPotConfig) *JellyPotClient {
+	urls := config.Jellyfin.urls()
+	if len(urls) == 0 {
+		report.add(CheckSkip, "Server", "no server URL is configured")
+		return nil
+	}
+	// The doctor only reads the device ID and token cache, so a run never changes what the bridge uses
+	deviceId := resolveDeviceId(config)
+	client := NewJellyPotClient(config.Jellyfin.ServerUrl, config.Jellyfin.Username, config.Jellyfin.Password,
+		deviceId)
+	client.UseServerUrls(urls)
+
+	reachable := false
+	for _, u := range urls {
+		probeCtx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+		started := time.Now()
+		err := client.probe(probeCtx, u)
+		cancel()
+		if err != nil {
+			report.add(CheckFail, "Server", u+"/System/Info/Public", err.Error())
+			continue
+		}
+		reachable = true
+		report.add(CheckPass, "Server", u+"/System/Info/Public",
+			fmt.Sprintf("answered in %d ms", time.Since(started).Milliseconds()))
+	}
+	if !reachable {
+		report.add(CheckSkip, "Login", "no server URL is reachable")
+		return nil
+	}
+
+	if deviceId == "" {
+		report.add(CheckSkip, "Login", "no device ID yet, start the bridge once to generate one")
+		return nil
+	}
+	if err := client.SelectServer(ctx); err != nil {
+		report.add(CheckFail, "Login", err.Error())
+		return nil
+	}
+	client.restoreToken(config.DataPath("token.json"))
+	method := "password"
+	if client.token() != "" {
+		method = "cached token"
+	}
+	if err := client.Login(ctx); err != nil {
+		report.add(CheckFail, "Login", err.Error())
+		return nil
+	}
+	report.add(CheckPass, "Login", fmt.Sprintf("logged in as %s with %s", client.username, method))
+	return client
+}
+
+// doctorPlayback resolves an item the way a jellypot:// link does and shows the resulting player command line
+func doctorPlayback(ctx context.Context, report *doctorReport, config *JellyPotConfig, client *JellyPotClient,
+	itemId string) {
+	if itemId == "" {
+		report.add(CheckSkip, "Playback", "pass an item ID or jellypot:// link to doctor to check playback")
+		return
+	}
+	bridge := NewBridge(config, client, nil)
+	target, err := bridge.Resolve(ctx, itemId, -1)
+	if err != nil {
+		report.add(CheckFail, "Playback", itemId, err.Error())
+		return
+	}
+
+	details := []string{
+		fmt.Sprintf("item: %s (%s), resume at %s", target.Item.Name, target.Item.Type, formatTicks(target.StartTicks)),
+	}
+	if target.MediaSource == nil {
+		report.add(CheckFail, "Playback", itemId, append(details, "no media source returned by PlaybackInfo")...)
+		return
+	}
+	details = append(details, fmt.Sprintf("media source: %s (%s)", target.MediaSource.Id,
+		target.MediaSource.Container))
+	args := expandLaunchArgs(config.launchArgs(), bridge.launchValues(target))
+	for i, arg := range args {
+		args[i] = strings.ReplaceAll(arg, client.token(), "<token>")
+	}
+	details = append(details, fmt.Sprintf("command: %q %q", config.PotPlayerPath, args))
+	report.add(CheckPass, "Playback", itemId, details...)
+}
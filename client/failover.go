@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Timeouts for probing the server URLs of a profile
+const (
+	ProbeTimeout       = 5 * time.Second
+	ProbeRetryInterval = 30 * time.Second // Minimum time between re-probes after failures
+)
+
+// UseServerUrls sets the alternative addresses of the server, such as a LAN address and a public domain
+// The first one stays active until SelectServer finds a faster one
+func (c *JellyPotClient) UseServerUrls(urls []string) {
+	c.urlMu.Lock()
+	defer c.urlMu.Unlock()
+	c.serverUrls = nil
+	for _, u := range urls {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u != "" && !c.hasServerUrlLocked(u) {
+			c.serverUrls = append(c.serverUrls, u)
+		}
+	}
+	if len(c.serverUrls) > 0 {
+		c.serverUrl = c.serverUrls[0]
+	}
+}
+
+// ServerUrl returns the server address currently in use
+func (c *JellyPotClient) ServerUrl() string {
+	c.urlMu.Lock()
+	defer c.urlMu.Unlock()
+	return c.serverUrl
+}
+
+// hasServerUrl reports whether u is one of the addresses of the server
+func (c *JellyPotClient) hasServerUrl(u string) bool {
+	c.urlMu.Lock()
+	defer c.urlMu.Unlock()
+	return sameServerUrl(u, c.serverUrl) || c.hasServerUrlLocked(u)
+}
+
+// hasServerUrlLocked is hasServerUrl for the alternative addresses; c.urlMu must be held
+func (c *JellyPotClient) hasServerUrlLocked(u string) bool {
+	for _, known := range c.serverUrls {
+		if sameServerUrl(u, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectServer probes every server address and switches to the fastest reachable one
+func (c *JellyPotClient) SelectServer(ctx context.Context) error {
+	c.urlMu.Lock()
+	urls := append([]string{}, c.serverUrls...)
+	c.lastProbe = time.Now()
+	c.urlMu.Unlock()
+	if len(urls) < 2 {
+		return nil
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	type result struct {
+		url     string
+		elapsed time.Duration
+		err     error
+	}
+	results := make(chan result, len(urls))
+	for _, u := range urls {
+		go func(u string) {
+			start := time.Now()
+			err := c.probe(probeCtx, u)
+			results <- result{url: u, elapsed: time.Since(start), err: err}
+		}(u)
+	}
+
+	// The first successful answer comes from the fastest address
+	var errs []error
+	for range urls {
+		r := <-results
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.url, r.err))
+			continue
+		}
+		c.urlMu.Lock()
+		changed := c.serverUrl != r.url
+		c.serverUrl = r.url
+		c.urlMu.Unlock()
+		if changed {
+			slog.Info("using server URL", "server", r.url, "elapsed", r.elapsed)
+		}
+		return nil
+	}
+	return fmt.Errorf("no server URL is reachable: %w", errors.Join(errs...))
+}
+
+// probe checks that a Jellyfin server answers at the given address
+func (c *JellyPotClient) probe(ctx context.Context, serverUrl string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", serverUrl+"/System/Info/Public", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) { _ = Body.Close() }(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Op: "probe", StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// failover re-probes the server addresses after a connection failure
+// Returns true when another address was selected
+func (c *JellyPotClient) failover(ctx context.Context) bool {
+	c.urlMu.Lock()
+	before := c.serverUrl
+	due := len(c.serverUrls) > 1 && time.Since(c.lastProbe) >= ProbeRetryInterval
+	if due {
+		c.lastProbe = time.Now()
+	}
+	c.urlMu.Unlock()
+	if !due {
+		return false
+	}
+
+	slog.Warn("server URL is failing, probing alternatives", "server", before)
+	if err := c.SelectServer(ctx); err != nil {
+		slog.Error("no server URL is reachable", "error", err)
+		return false
+	}
+	return c.ServerUrl() != before
+}
+
+// isConnectionFailure reports whether an error means the active server address is unreachable
+func isConnectionFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		// A reverse proxy answers for the server when the upstream is gone
+		return statusErr.StatusCode == http.StatusBadGateway ||
+			statusErr.StatusCode == http.StatusServiceUnavailable ||
+			statusErr.StatusCode == http.StatusGatewayTimeout
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Commands understood by a running instance
+const (
+	InstanceCommandPlay    = "play"
+	InstanceCommandEnqueue = "enqueue"
+	InstanceCommandStatus  = "status"
+	InstanceCommandStop    = "stop"
+)
+
+// InstanceRequest is a JSON message sent by a new launch to the running instance
+type InstanceRequest struct {
+	Command string `json:"command"`
+	ItemId  string `json:"itemId,omitempty"`
+	Server  string `json:"server,omitempty"` // Server profile name or URL, empty for any
+}
+
+// InstanceResponse is the JSON reply of the running instance
+type InstanceResponse struct {
+	Ok          bool          `json:"ok"`
+	Error       string        `json:"error,omitempty"`
+	OtherServer bool          `json:"otherServer,omitempty"` // The request is for a different server profile
+	Status      *BridgeStatus `json:"status,omitempty"`
+}
+
+// InstanceCommandHandler applies requests received from other instances
+type InstanceCommandHandler interface {
+	HandleInstanceRequest(ctx context.Context, request InstanceRequest) InstanceResponse
+}
+
+// instanceRequestMu is held while a request from another instance is answered
+var instanceRequestMu sync.Mutex
+
+// waitForInstanceRequest blocks until the response to the request being answered, if any, has been written
+// It is called before exiting, as a stop request ends the process while its response is still being sent
+func waitForInstanceRequest() {
+	instanceRequestMu.Lock()
+}
+
+// dispatchInstanceRequest decodes a request, applies it and encodes the response
+func dispatchInstanceRequest(ctx context.Context, msg []byte, handler InstanceCommandHandler) []byte {
+	var request InstanceRequest
+	response := InstanceResponse{}
+	if err := json.Unmarshal(msg, &request); err != nil {
+		response.Error = fmt.Sprintf("invalid request: %v", err)
+	} else {
+		response = handler.HandleInstanceRequest(ctx, request)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		data = []byte(`{"ok":false,"error":"failed to encode response"}`)
+	}
+	return data
+}
+
+// parseInstanceResponse decodes a response and converts a failure into an error
+func parseInstanceResponse(msg []byte) (*InstanceResponse, error) {
+	var response InstanceResponse
+	if err := json.Unmarshal(msg, &response); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if !response.Ok {
+		return &response, errors.New(response.Error)
+	}
+	return &response, nil
+}
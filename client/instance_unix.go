@@ -0,0 +1,110 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	SocketName = "jellypotbridge.sock"
+)
+
+// socketPath returns the location of the single-instance socket, preferring $XDG_RUNTIME_DIR
+func socketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, SocketName)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("jellypotbridge-%d.sock", os.Getuid()))
+}
+
+// EnsureSingleInstance claims the single-instance socket and serves requests from later launches
+func EnsureSingleInstance(ctx context.Context, handler InstanceCommandHandler) bool {
+	listener, err := createSocketServer()
+	if err != nil {
+		slog.Error("failed to claim the single instance", "error", err)
+		return false
+	}
+	go listenForNewInstances(ctx, listener, handler)
+	return true
+}
+
+// createSocketServer listens on the single-instance socket, removing a stale one left by a crashed instance
+func createSocketServer() (net.Listener, error) {
+	path := socketPath()
+	listener, err := net.Listen("unix", path)
+	if err == nil {
+		return listener, nil
+	}
+
+	if conn, dialErr := net.DialTimeout("unix", path, time.Second); dialErr == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("another instance is listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return net.Listen("unix", path)
+}
+
+// listenForNewInstances waits for new instances and answers their requests
+func listenForNewInstances(ctx context.Context, listener net.Listener, handler InstanceCommandHandler) {
+	defer func(listener net.Listener) { _ = listener.Close() }(listener)
+	go func() {
+		// Unblock Accept and remove the socket when shutting down
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+
+		instanceRequestMu.Lock()
+		var msg json.RawMessage
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := json.NewDecoder(conn).Decode(&msg); err == nil {
+			_, _ = conn.Write(dispatchInstanceRequest(ctx, msg, handler))
+		}
+		_ = conn.Close()
+		instanceRequestMu.Unlock()
+	}
+}
+
+// notifyExistingInstance sends a request to the running instance
+// Returns false when no instance is running
+func notifyExistingInstance(request InstanceRequest) (bool, *InstanceResponse, error) {
+	conn, err := net.DialTimeout("unix", socketPath(), time.Second)
+	if err != nil {
+		return false, nil, nil // No existing instance
+	}
+	defer func(conn net.Conn) { _ = conn.Close() }(conn)
+
+	msg, err := json.Marshal(request)
+	if err != nil {
+		return true, nil, err
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return true, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		_ = unixConn.CloseWrite()
+	}
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		return true, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	response, err := parseInstanceResponse(data)
+	return true, response, err
+}
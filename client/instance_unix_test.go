@@ -0,0 +1,87 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+)
+
+// fakeInstanceHandler records the requests it receives and answers with a fixed status
+type fakeInstanceHandler struct {
+	requests chan InstanceRequest
+}
+
+func (h *fakeInstanceHandler) HandleInstanceRequest(_ context.Context, request InstanceRequest) InstanceResponse {
+	h.requests <- request
+	return InstanceResponse{Ok: true, Status: &BridgeStatus{State: PlaybackStatePlaying, ItemId: request.ItemId}}
+}
+
+// TestCreateSocketServerRemovesStaleSocket checks that a socket left behind by a crashed instance is replaced
+func TestCreateSocketServerRemovesStaleSocket(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	stale, err := net.Listen("unix", socketPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Closing without unlinking leaves the socket file as a crash would
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+	if _, err := os.Stat(socketPath()); err != nil {
+		t.Fatalf("stale socket missing: %v", err)
+	}
+
+	listener, err := createSocketServer()
+	if err != nil {
+		t.Fatalf("createSocketServer() error = %v", err)
+	}
+	_ = listener.Close()
+}
+
+// TestCreateSocketServerRefusesSecondInstance checks that a running instance keeps its socket
+func TestCreateSocketServerRefusesSecondInstance(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	first, err := createSocketServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(first net.Listener) { _ = first.Close() }(first)
+
+	if second, err := createSocketServer(); err == nil {
+		_ = second.Close()
+		t.Fatal("createSocketServer() succeeded while another instance is listening")
+	}
+}
+
+// TestNotifyExistingInstance sends a request through the socket and checks the handler and the response
+func TestNotifyExistingInstance(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	if running, _, err := notifyExistingInstance(InstanceRequest{Command: InstanceCommandStatus}); running || err != nil {
+		t.Fatalf("notifyExistingInstance() without instance = %v, %v", running, err)
+	}
+
+	listener, err := createSocketServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := &fakeInstanceHandler{requests: make(chan InstanceRequest, 1)}
+	go listenForNewInstances(ctx, listener, handler)
+
+	running, response, err := notifyExistingInstance(InstanceRequest{Command: InstanceCommandPlay, ItemId: "item"})
+	if !running || err != nil {
+		t.Fatalf("notifyExistingInstance() = %v, %v", running, err)
+	}
+	if request := <-handler.requests; request.Command != InstanceCommandPlay || request.ItemId != "item" {
+		t.Errorf("handler received %+v", request)
+	}
+	if response.Status == nil || response.Status.ItemId != "item" || response.Status.State != PlaybackStatePlaying {
+		t.Errorf("response = %+v", response)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	PipeName = `\\.\pipe\JellyPotBridge_39AC4C3F`
+)
+
+// PipeBusyTimeout bounds how long a new launch waits while the running instance answers another request,
+// which may involve several calls to Jellyfin
+const PipeBusyTimeout = 30 * time.Second
+
+var procWaitNamedPipe = windows.NewLazySystemDLL("kernel32.dll").NewProc("WaitNamedPipeW")
+
+// EnsureSingleInstance claims the single-instance pipe and serves requests from later launches
+func EnsureSingleInstance(ctx context.Context, handler InstanceCommandHandler) bool {
+	pipe, err := createPipeServer()
+	if err != nil {
+		slog.Error("failed to claim the single instance", "error", err)
+		return false
+	}
+	go listenForNewInstances(ctx, pipe, handler)
+	return true
+}
+
+// createPipeServer establishes a new named pipe server
+func createPipeServer() (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(PipeName)
+	if err != nil {
+		return 0, err
+	}
+
+	return windows.CreateNamedPipe(
+		name,
+		windows.PIPE_ACCESS_DUPLEX|windows.FILE_FLAG_FIRST_PIPE_INSTANCE,
+		windows.PIPE_TYPE_MESSAGE|windows.PIPE_READMODE_MESSAGE|windows.PIPE_WAIT,
+		1, 4096, 4096, 500, nil,
+	)
+}
+
+// listenForNewInstances waits for new instances and answers their requests
+func listenForNewInstances(ctx context.Context, pipe windows.Handle, handler InstanceCommandHandler) {
+	defer func(handle windows.Handle) { _ = windows.CloseHandle(handle) }(pipe)
+	buffer := make([]byte, 4096)
+
+	for {
+		// Wait for connection
+		if err := windows.ConnectNamedPipe(pipe, nil); err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+			break
+		}
+
+		// Read request and write response
+		instanceRequestMu.Lock()
+		if msg, err := readPipeMessage(pipe, buffer); err == nil {
+			response := dispatchInstanceRequest(ctx, msg, handler)
+			var bytesWritten uint32
+			_ = windows.WriteFile(pipe, response, &bytesWritten, nil)
+			_ = windows.FlushFileBuffers(pipe)
+		}
+
+		_ = windows.DisconnectNamedPipe(pipe)
+		instanceRequestMu.Unlock()
+	}
+}
+
+// notifyExistingInstance sends a request to the running instance
+// Returns false when no instance is running
+func notifyExistingInstance(request InstanceRequest) (bool, *InstanceResponse, error) {
+	handle, err := openPipe()
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return false, nil, nil // No existing instance
+	}
+	if err != nil {
+		return true, nil, fmt.Errorf("failed to connect to the running instance: %w", err)
+	}
+	defer func(handle windows.Handle) { _ = windows.CloseHandle(handle) }(handle)
+
+	msg, err := json.Marshal(request)
+	if err != nil {
+		return true, nil, err
+	}
+	var bytesWritten uint32
+	if err := windows.WriteFile(handle, msg, &bytesWritten, nil); err != nil {
+		return true, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	data, err := readPipeMessage(handle, make([]byte, 4096))
+	if err != nil {
+		return true, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	response, err := parseInstanceResponse(data)
+	return true, response, err
+}
+
+// openPipe connects to the pipe of the running instance in message mode
+// While the single pipe instance is busy with another request it waits up to PipeBusyTimeout for it to free up
+func openPipe() (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(PipeName)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(PipeBusyTimeout)
+	for {
+		handle, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE,
+			0, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+		if err == nil {
+			mode := uint32(windows.PIPE_READMODE_MESSAGE)
+			if err := windows.SetNamedPipeHandleState(handle, &mode, nil, nil); err != nil {
+				_ = windows.CloseHandle(handle)
+				return 0, err
+			}
+			return handle, nil
+		}
+		remaining := time.Until(deadline)
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) || remaining <= 0 {
+			return 0, err
+		}
+		// WaitNamedPipe fails with ERROR_FILE_NOT_FOUND once the pipe is gone, which ends the loop
+		// through CreateFile; another launch may also claim the freed pipe first, so try again
+		_, _, _ = procWaitNamedPipe.Call(uintptr(unsafe.Pointer(name)), uintptr(remaining.Milliseconds()))
+	}
+}
+
+// readPipeMessage reads a whole message from a message-mode pipe, which may take several reads
+// when the message is larger than buffer
+func readPipeMessage(pipe windows.Handle, buffer []byte) ([]byte, error) {
+	var msg []byte
+	for {
+		var bytesRead uint32
+		err := windows.ReadFile(pipe, buffer, &bytesRead, nil)
+		msg = append(msg, buffer[:bytesRead]...)
+		if !errors.Is(err, windows.ERROR_MORE_DATA) {
+			return msg, err
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// PlaybackStatusEvent represents the playback status to send to Jellyfin
+type PlaybackStatusEvent struct {
+	PositionTicks          int64  `json:"PositionTicks"`
+	PlaybackStartTimeTicks int64  `json:"PlaybackStartTimeTicks"`
+	PlayMethod             string `json:"PlayMethod"`
+	MediaSourceId          string `json:"MediaSourceId"`
+	CanSeek                bool   `json:"CanSeek"`
+	ItemId                 string `json:"ItemId"`
+	EventName              string `json:"EventName"`
+	PlaySessionId          string `json:"PlaySessionId,omitempty"`
+	SessionId              string `json:"SessionId,omitempty"`
+}
+
+// SessionInfo represents a client session on the Jellyfin server
+type SessionInfo struct {
+	Id                    string   `json:"Id"`
+	UserId                string   `json:"UserId"`
+	UserName              string   `json:"UserName"`
+	Client                string   `json:"Client"`
+	DeviceId              string   `json:"DeviceId"`
+	DeviceName            string   `json:"DeviceName"`
+	ApplicationVersion    string   `json:"ApplicationVersion"`
+	IsActive              bool     `json:"IsActive"`
+	SupportsMediaControl  bool     `json:"SupportsMediaControl"`
+	SupportsRemoteControl bool     `json:"SupportsRemoteControl"`
+	PlayableMediaTypes    []string `json:"PlayableMediaTypes"`
+	SupportedCommands     []string `json:"SupportedCommands"`
+}
+
+// ClientCapabilities describes what this client can do, as posted to Jellyfin
+type ClientCapabilities struct {
+	PlayableMediaTypes           []string `json:"PlayableMediaTypes"`
+	SupportedCommands            []string `json:"SupportedCommands"`
+	SupportsMediaControl         bool     `json:"SupportsMediaControl"`
+	SupportsPersistentIdentifier bool     `json:"SupportsPersistentIdentifier"`
+}
+
+// PlaybackInfo represents the playback information Jellyfin returns for an item
+type PlaybackInfo struct {
+	PlaySessionId string            `json:"PlaySessionId"`
+	MediaSources  []MediaSourceInfo `json:"MediaSources"`
+}
+
+// MediaSourceInfo represents a single media source of a Jellyfin item
+type MediaSourceInfo struct {
+	Id                         string        `json:"Id"`
+	Name                       string        `json:"Name"`
+	Container                  string        `json:"Container"`
+	MediaStreams               []MediaStream `json:"MediaStreams"`
+	DefaultAudioStreamIndex    *int          `json:"DefaultAudioStreamIndex"`
+	DefaultSubtitleStreamIndex *int          `json:"DefaultSubtitleStreamIndex"`
+}
+
+// MediaStream represents an audio, video or subtitle stream of a media source
+type MediaStream struct {
+	Index                int    `json:"Index"`
+	Type                 string `json:"Type"`
+	Codec                string `json:"Codec"`
+	Language             string `json:"Language"`
+	IsExternal           bool   `json:"IsExternal"`
+	IsTextSubtitleStream bool   `json:"IsTextSubtitleStream"`
+}
+
+// MediaItem represents a media item from Jellyfin
+type MediaItem struct {
+	Id           string   `json:"Id"`
+	Name         string   `json:"Name"`
+	Type         string   `json:"Type"`
+	RunTimeTicks int64    `json:"RunTimeTicks"`
+	UserData     UserData `json:"UserData"`
+}
+
+// UserData represents a user data within a Jellyfin media item
+type UserData struct {
+	PlaybackPositionTicks int64  `json:"PlaybackPositionTicks"`
+	ItemId                string `json:"ItemId"`
+}
+
+// JellyPotClient handles communication with the Jellyfin server
+type JellyPotClient struct {
+	urlMu         sync.Mutex
+	serverUrl     string
+	serverUrls    []string
+	lastProbe     time.Time
+	username      string
+	password      string
+	authMu        sync.Mutex // Guards accessToken, sessionId and userId, which the WebSocket also uses
+	accessToken   string
+	sessionId     string
+	userId        string
+	loginMu       sync.Mutex // Serialises logins so concurrent 401s re-authenticate once
+	tokenPath     string
+	httpClient    *http.Client
+	retry         RetryPolicy
+	deviceName    string
+	deviceId      string
+	clientName    string
+	clientVersion string
+}
+
+// NewJellyPotClient creates a new JellyPotClient instance
+func NewJellyPotClient(serverUrl, username, password string, deviceId string) *JellyPotClient {
+	return &JellyPotClient{
+		serverUrl:     serverUrl,
+		username:      username,
+		password:      password,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		retry:         DefaultRetryPolicy,
+		deviceName:    getDeviceName(),
+		deviceId:      deviceId,
+		clientName:    "JellyPot",
+		clientVersion: gVersion,
+	}
+}
+
+// Errors returned by JellyPotClient, wrapped in a StatusError carrying the exact status code
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrServer       = errors.New("server error")
+)
+
+// StatusError is returned when Jellyfin answers with an unexpected HTTP status code
+type StatusError struct {
+	Op         string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed with status code: %d", e.Op, e.StatusCode)
+}
+
+// statusCode returns the HTTP status of a request Jellyfin rejected, or 0 when it did not answer with one
+func statusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// Unwrap classifies the status code so callers can use errors.Is with ErrUnauthorized, ErrNotFound or ErrServer
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	default:
+		return nil
+	}
+}
+
+// Authenticate logs into the Jellyfin server and retrieves an access token
+func (c *JellyPotClient) Authenticate(ctx context.Context) error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	return c.authenticateLocked(ctx)
+}
+
+// reauthenticate logs in again unless another request already replaced the token stale
+// Requests that fail together with the same token therefore share a single login
+func (c *JellyPotClient) reauthenticate(ctx context.Context, stale string) error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	if c.token() != stale {
+		return nil
+	}
+	if err := c.authenticateLocked(ctx); err != nil {
+		return err
+	}
+	if stale != "" {
+		metrics.RecordAuthRefresh()
+	}
+	return nil
+}
+
+// authenticateLocked logs in with the credentials; c.loginMu must be held
+// The previous token stays in use by other requests until the new one has arrived
+func (c *JellyPotClient) authenticateLocked(ctx context.Context) error {
+	type authRequest struct {
+		Username string `json:"Username"`
+		Password string `json:"Pw"`
+	}
+
+	type authResponse struct {
+		AccessToken string      `json:"AccessToken"`
+		SessionInfo SessionInfo `json:"SessionInfo"`
+	}
+
+	// The stale token is not sent along with the credentials
+	var authResp authResponse
+	request := authRequest{Username: c.username, Password: c.password}
+	err := c.send(ctx, "", "authentication", "POST", "/Users/AuthenticateByName", request, &authResp)
+	if isConnectionFailure(ctx, err) && c.failover(ctx) {
+		err = c.send(ctx, "", "authentication", "POST", "/Users/AuthenticateByName", request, &authResp)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.setAuthState(authResp.AccessToken, authResp.SessionInfo.Id, authResp.SessionInfo.UserId)
+	c.saveToken()
+	slog.Info("authenticated", "username", c.username, "server", c.ServerUrl())
+	return nil
+}
+
+// Login signs in with the cached access token when it is still valid, and with the credentials otherwise
+func (c *JellyPotClient) Login(ctx context.Context) error {
+	if c.token() == "" {
+		return c.Authenticate(ctx)
+	}
+
+	// A stale token is answered with 401, which makes do log in with the credentials
+	sessions, err := c.GetSessions(ctx)
+	if err != nil {
+		return err
+	}
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	if c.sessionId == "" {
+		for _, session := range sessions {
+			if session.UserId == c.userId {
+				c.sessionId = session.Id
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// authState returns the access token, session ID and user ID of the current login
+func (c *JellyPotClient) authState() (token, sessionId, userId string) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	return c.accessToken, c.sessionId, c.userId
+}
+
+// token returns the current access token, empty before the first login
+func (c *JellyPotClient) token() string {
+	token, _, _ := c.authState()
+	return token
+}
+
+// setAuthState replaces the access token, session ID and user ID after a login
+func (c *JellyPotClient) setAuthState(token, sessionId, userId string) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	c.accessToken, c.sessionId, c.userId = token, sessionId, userId
+}
+
+// UpdatePlaybackStatus sends the current playback status to Jellyfin
+func (c *JellyPotClient) UpdatePlaybackStatus(ctx context.Context, event PlaybackStatusEvent) error {
+	return c.postPlaybackEvent(ctx, "update playback status", "/Sessions/Playing/Progress", event)
+}
+
+// ReportPlaybackStopped tells Jellyfin that playback of an item has stopped
+func (c *JellyPotClient) ReportPlaybackStopped(ctx context.Context, event PlaybackStatusEvent) error {
+	return c.postPlaybackEvent(ctx, "report playback stopped", "/Sessions/Playing/Stopped", event)
+}
+
+// ReportPlaybackStart tells Jellyfin that playback of an item has started
+func (c *JellyPotClient) ReportPlaybackStart(ctx context.Context, event PlaybackStatusEvent) error {
+	return c.postPlaybackEvent(ctx, "report playback start", "/Sessions/Playing", event)
+}
+
+// postPlaybackEvent sends a playback event to the given Jellyfin session endpoint, retrying transient failures
+func (c *JellyPotClient) postPlaybackEvent(ctx context.Context, op, path string, event PlaybackStatusEvent) error {
+	return c.retry.Do(ctx, func(ctx context.Context) error {
+		if event.SessionId == "" {
+			_, event.SessionId, _ = c.authState()
+		}
+		return c.do(ctx, op, "POST", path, event, nil)
+	})
+}
+
+// GetItem retrieves details about a specific media item from Jellyfin
+func (c *JellyPotClient) GetItem(ctx context.Context, itemId string) (*MediaItem, error) {
+	// The path needs the user ID, which is only known after authentication
+	if err := c.ensureAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+
+	_, _, userId := c.authState()
+	var item MediaItem
+	path := fmt.Sprintf("/Users/%s/Items/%s", userId, itemId)
+	if err := c.do(ctx, "get item", "GET", path, nil, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetPlaybackInfo retrieves the playback information, including a new play session ID, for an item
+func (c *JellyPotClient) GetPlaybackInfo(ctx context.Context, itemId string) (*PlaybackInfo, error) {
+	if err := c.ensureAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+
+	_, _, userId := c.authState()
+	var info PlaybackInfo
+	path := fmt.Sprintf("/Items/%s/PlaybackInfo?userId=%s", itemId, userId)
+	if err := c.do(ctx, "get playback info", "POST", path, struct{}{}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetSessions lists the sessions Jellyfin holds for this device
+func (c *JellyPotClient) GetSessions(ctx context.Context) ([]SessionInfo, error) {
+	var sessions []SessionInfo
+	if err := c.do(ctx, "get sessions", "GET", "/Sessions?deviceId="+url.QueryEscape(c.deviceId),
+		nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// PostCapabilities reports the capabilities of this client for the current session
+func (c *JellyPotClient) PostCapabilities(ctx context.Context, capabilities ClientCapabilities) error {
+	return c.do(ctx, "post capabilities", "POST", "/Sessions/Capabilities/Full", capabilities, nil)
+}
+
+// ensureAuthenticated logs in when there is no access token yet
+func (c *JellyPotClient) ensureAuthenticated(ctx context.Context) error {
+	if c.token() != "" {
+		return nil
+	}
+	return c.reauthenticate(ctx, "")
+}
+
+// do sends an authenticated request to Jellyfin
+// On 401 the client re-authenticates once and replays the request, and when the server address
+// is unreachable it switches to another address of the server first
+func (c *JellyPotClient) do(ctx context.Context, op, method, path string, body, out any) error {
+	if err := c.ensureAuthenticated(ctx); err != nil {
+		return err
+	}
+
+	token := c.token()
+	err := c.send(ctx, token, op, method, path, body, out)
+	if isConnectionFailure(ctx, err) && c.failover(ctx) {
+		err = c.send(ctx, token, op, method, path, body, out)
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		// The token expired or was revoked on the server
+		if authErr := c.reauthenticate(ctx, token); authErr != nil {
+			return authErr
+		}
+		err = c.doOnce(ctx, op, method, path, body, out)
+	}
+	return err
+}
+
+// doOnce sends a single request with the current access token
+func (c *JellyPotClient) doOnce(ctx context.Context, op, method, path string, body, out any) error {
+	return c.send(ctx, c.token(), op, method, path, body, out)
+}
+
+// send sends a single request with the given access token, or none when it is empty, encoding body and
+// decoding the response into out when they are not nil
+func (c *JellyPotClient) send(ctx context.Context, token, op, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to create %s request: %w", op, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.ServerUrl()+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", c.authorizationHeader(token))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	attrs := requestAttrs(op, method, path, body)
+	started := time.Now()
+	resp, err := c.httpClient.Do(req)
+	attrs = append(attrs, slog.Duration("elapsed", time.Since(started)))
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "request failed", append(attrs, slog.Any("error", err))...)
+		return fmt.Errorf("failed to send %s request: %w", op, err)
+	}
+	defer func(Body io.ReadCloser) { _ = Body.Close() }(resp.Body)
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.LogAttrs(ctx, slog.LevelWarn, "request failed", attrs...)
+		return &StatusError{Op: op, StatusCode: resp.StatusCode}
+	}
+	slog.LogAttrs(ctx, slog.LevelDebug, "request", attrs...)
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to parse %s response: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// requestAttrs describes a request for the log, including the item and event of playback reports
+func requestAttrs(op, method, path string, body any) []slog.Attr {
+	attrs := []slog.Attr{slog.String("op", op), slog.String("method", method), slog.String("path", path)}
+	if event, ok := body.(PlaybackStatusEvent); ok {
+		attrs = append(attrs, slog.String("item_id", event.ItemId), slog.String("event", event.EventName),
+			slog.Int64("position_ticks", event.PositionTicks))
+	}
+	return attrs
+}
+
+// authorizationHeader builds the MediaBrowser authorization header value for the given access token
+func (c *JellyPotClient) authorizationHeader(token string) string {
+	if token == "" {
+		return fmt.Sprintf(
+			"MediaBrowser Client=\"%s\", Device=\"%s\", DeviceId=\"%s\", Version=\"%s\"",
+			c.clientName, c.deviceName, c.deviceId, c.clientVersion,
+		)
+	}
+	return fmt.Sprintf(
+		"MediaBrowser Token=\"%s\", Client=\"%s\", Device=\"%s\", DeviceId=\"%s\", Version=\"%s\"",
+		token, c.clientName, c.deviceName, c.deviceId, c.clientVersion,
+	)
+}
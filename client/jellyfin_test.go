@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestConcurrentUnauthorizedLogsInOnce checks that requests rejected together share one login
+// and that the old token stays in use until the new one has arrived
+func TestConcurrentUnauthorizedLogsInOnce(t *testing.T) {
+	var logins, anonymous atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if r.URL.Path == "/Users/AuthenticateByName" {
+			logins.Add(1)
+			time.Sleep(50 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"AccessToken":"new","SessionInfo":{"Id":"session","UserId":"user"}}`))
+			return
+		}
+		switch {
+		case !strings.Contains(authorization, "Token="):
+			anonymous.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		case strings.Contains(authorization, `Token="new"`):
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	client := NewJellyPotClient(server.URL, "user", "password", "device")
+	client.setAuthState("old", "", "user")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetSessions(context.Background())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("GetSessions() error = %v", err)
+		}
+	}
+	if n := logins.Load(); n != 1 {
+		t.Errorf("logins = %d, want 1", n)
+	}
+	if n := anonymous.Load(); n != 0 {
+		t.Errorf("requests without a token = %d, want 0", n)
+	}
+	if token := client.token(); token != "new" {
+		t.Errorf("token = %q, want %q", token, "new")
+	}
+}
+
+// TestAuthRefreshesCountsLogins checks that 401s sharing one login count as one refresh
+// and that a rejected login is not counted
+func TestAuthRefreshesCountsLogins(t *testing.T) {
+	var rejectLogin atomic.Bool
+	release := make(chan struct{})
+	var rejected sync.WaitGroup
+	rejected.Add(2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/Users/AuthenticateByName" {
+			if rejectLogin.Load() {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"AccessToken":"new","SessionInfo":{"Id":"session","UserId":"user"}}`))
+			return
+		}
+		if strings.Contains(r.Header.Get("Authorization"), `Token="new"`) {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		// Hold both requests until each has been rejected with the old token
+		rejected.Done()
+		<-release
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	authRefreshes := func() uint64 {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return metrics.authRefreshes
+	}
+	before := authRefreshes()
+
+	client := NewJellyPotClient(server.URL, "user", "password", "device")
+	client.setAuthState("old", "", "user")
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetSessions(context.Background()); err != nil {
+				t.Errorf("GetSessions() error = %v", err)
+			}
+		}()
+	}
+	rejected.Wait()
+	close(release)
+	wg.Wait()
+	if n := authRefreshes() - before; n != 1 {
+		t.Errorf("auth refreshes = %d, want 1", n)
+	}
+
+	rejectLogin.Store(true)
+	client.setAuthState("old", "", "user")
+	rejected.Add(1) // release is already closed, so the request is rejected at once
+	if _, err := client.GetSessions(context.Background()); err == nil {
+		t.Error("GetSessions() error = nil, want the rejected login")
+	}
+	if n := authRefreshes() - before; n != 1 {
+		t.Errorf("auth refreshes after a rejected login = %d, want 1", n)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultLaunchArgs are the PotPlayer arguments used when launch-args is not set
+var DefaultLaunchArgs = []string{"{url}", "/title={title}", "/seek={startSeconds}", "/current"}
+
+// LaunchPlaceholders lists the placeholders launch-args may contain
+var LaunchPlaceholders = []string{"url", "title", "startSeconds", "subtitleUrl", "audioIndex"}
+
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// launchArgs returns the configured launch-args, or DefaultLaunchArgs when none are set
+func (c *JellyPotConfig) launchArgs() []string {
+	if len(c.LaunchArgs) > 0 {
+		return c.LaunchArgs
+	}
+	return DefaultLaunchArgs
+}
+
+// launchValues returns the placeholder values for launching the player on target; b.mu must be held
+func (b *Bridge) launchValues(target *PlaybackTarget) map[string]string {
+	serverUrl, token := b.client.ServerUrl(), b.client.token()
+	values := map[string]string{
+		"url":          fmt.Sprintf("%s/Items/%s/Download?api_key=%s", serverUrl, target.Item.Id, token),
+		"title":        target.Item.Name,
+		"startSeconds": strconv.FormatInt(target.StartTicks/TicksPerMillisecond/1000, 10),
+	}
+	source := target.MediaSource
+	if source == nil {
+		return values
+	}
+	if source.DefaultAudioStreamIndex != nil {
+		values["audioIndex"] = strconv.Itoa(*source.DefaultAudioStreamIndex)
+	}
+	if source.DefaultSubtitleStreamIndex != nil {
+		for _, stream := range source.MediaStreams {
+			// Jellyfin can only serve text subtitles as a file of their own
+			if stream.Index == *source.DefaultSubtitleStreamIndex && stream.Type == "Subtitle" &&
+				stream.IsTextSubtitleStream {
+				values["subtitleUrl"] = fmt.Sprintf("%s/Videos/%s/%s/Subtitles/%d/Stream.%s?api_key=%s",
+					serverUrl, target.Item.Id, source.Id, stream.Index, subtitleFormat(stream.Codec), token)
+			}
+		}
+	}
+	return values
+}
+
+// subtitleFormat returns the file extension Jellyfin serves a subtitle codec as
+func subtitleFormat(codec string) string {
+	switch codec = strings.ToLower(codec); codec {
+	case "", "subrip":
+		return "srt"
+	case "webvtt":
+		return "vtt"
+	default:
+		return codec
+	}
+}
+
+// expandLaunchArgs replaces the placeholders in args with values
+// An argument is left out when one of its placeholders has no value, such as {subtitleUrl} for an item
+// without a default text subtitle
+func expandLaunchArgs(args []string, values map[string]string) []string {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		missing := false
+		arg = placeholderPattern.ReplaceAllStringFunc(arg, func(match string) string {
+			value, ok := values[match[1:len(match)-1]]
+			if !ok || value == "" {
+				missing = true
+			}
+			return value
+		})
+		if !missing {
+			expanded = append(expanded, arg)
+		}
+	}
+	return expanded
+}
+
+// checkLaunchArgs checks that args only use known placeholders and pass the media URL to the player
+func checkLaunchArgs(args []string) error {
+	hasUrl := false
+	for _, arg := range args {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(arg, -1) {
+			if match[1] == "url" {
+				hasUrl = true
+			}
+			if !slices.Contains(LaunchPlaceholders, match[1]) {
+				return fmt.Errorf("unknown placeholder %s in %q, use one of {%s}", match[0], arg,
+					strings.Join(LaunchPlaceholders, "}, {"))
+			}
+		}
+	}
+	if !hasUrl {
+		return errors.New("must contain {url}")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestExpandLaunchArgs checks that placeholders are replaced and arguments without a value are left out
+func TestExpandLaunchArgs(t *testing.T) {
+	values := map[string]string{
+		"url":          "http://jellyfin.lan/Items/1/Download?api_key=token",
+		"title":        "Big Buck Bunny",
+		"startSeconds": "90",
+		"subtitleUrl":  "",
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "default",
+			args: DefaultLaunchArgs,
+			want: []string{"http://jellyfin.lan/Items/1/Download?api_key=token", "/title=Big Buck Bunny",
+				"/seek=90", "/current"},
+		},
+		{
+			name: "several placeholders in one argument",
+			args: []string{"{url}", "/title={title} ({startSeconds}s)"},
+			want: []string{"http://jellyfin.lan/Items/1/Download?api_key=token", "/title=Big Buck Bunny (90s)"},
+		},
+		{
+			name: "empty placeholder drops the argument",
+			args: []string{"{url}", "/sub={subtitleUrl}", "/fullscreen"},
+			want: []string{"http://jellyfin.lan/Items/1/Download?api_key=token", "/fullscreen"},
+		},
+		{
+			name: "missing placeholder drops the argument",
+			args: []string{"{url}", "/audio={audioIndex}"},
+			want: []string{"http://jellyfin.lan/Items/1/Download?api_key=token"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := expandLaunchArgs(test.args, values); !slices.Equal(got, test.want) {
+				t.Errorf("expandLaunchArgs(%q) = %q, want %q", test.args, got, test.want)
+			}
+		})
+	}
+}
+
+// TestCheckLaunchArgs checks that unknown placeholders and templates without {url} are rejected
+func TestCheckLaunchArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "default", args: DefaultLaunchArgs},
+		{name: "every placeholder", args: []string{"{url}", "/title={title}", "/seek={startSeconds}",
+			"/sub={subtitleUrl}", "/audio={audioIndex}"}},
+		{name: "unknown placeholder", args: []string{"{url}", "/monitor={screen}"},
+			wantErr: `unknown placeholder {screen} in "/monitor={screen}"`},
+		{name: "placeholder case", args: []string{"{URL}"}, wantErr: "unknown placeholder {URL}"},
+		{name: "no url", args: []string{"/title={title}"}, wantErr: "must contain {url}"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkLaunchArgs(test.args)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("checkLaunchArgs(%q) error = %v, want nil", test.args, err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("checkLaunchArgs(%q) error = %v, want %q", test.args, err, test.wantErr)
+			}
+		})
+	}
+}
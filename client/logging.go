@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Log file settings; the file is rotated to jellypotbridge.log.1, .2 and so on once it reaches MaxLogFileSize
+const (
+	LogFileName    = "jellypotbridge.log"
+	MaxLogFileSize = 5 << 20
+	MaxLogFiles    = 3
+)
+
+// logLevel is the minimum level written to the log file, changed by log-level on reload
+var logLevel = new(slog.LevelVar)
+
+func init() {
+	// Nothing is logged until openLog is called, such as by the instance commands and the setup wizard
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+}
+
+// parseLogLevel parses a log-level value such as debug, info, warn or error; empty means info
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(value) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return level, errors.New("must be debug, info, warn or error")
+	}
+	return level, nil
+}
+
+// setLogLevel changes the minimum level of the log file, keeping the current one when value is invalid
+func setLogLevel(value string) {
+	if level, err := parseLogLevel(value); err == nil {
+		logLevel.Set(level)
+	}
+}
+
+// openLog sends slog records to the rotating log file in the data directory and to the console,
+// and returns the path of the file
+// Events are logged once and reach both, so nothing is lost when the console is hidden during playback
+func openLog(level string) (string, io.Closer, error) {
+	path := filepath.Join(dataDir(), "logs", LogFileName)
+	file, err := newRotatingFile(path)
+	if err != nil {
+		slog.SetDefault(slog.New(newConsoleHandler(os.Stdout)))
+		return "", nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	setLogLevel(level)
+	slog.SetDefault(slog.New(multiHandler{
+		slog.NewTextHandler(file, &slog.HandlerOptions{Level: logLevel}),
+		newConsoleHandler(os.Stdout),
+	}))
+	return path, file, nil
+}
+
+// newConsoleHandler writes records from info up to w, without the time the log file already has
+func newConsoleHandler(w io.Writer) slog.Handler {
+	return slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+}
+
+// multiHandler passes every record to each of its handlers that is enabled for its level
+type multiHandler []slog.Handler
+
+func (h multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// rotatingFile is a log file that is renamed with a numbered suffix once it grows past MaxLogFileSize
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+// newRotatingFile opens path for appending, creating its directory
+func newRotatingFile(path string) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file and records its current size
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.size+int64(len(p)) > MaxLogFileSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the numbered log files up by one, dropping the oldest, and starts a new file
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	for i := MaxLogFiles - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
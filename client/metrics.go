@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Metrics counts what the bridge has sent to Jellyfin, for the Prometheus /metrics endpoint
+type Metrics struct {
+	mu            sync.Mutex
+	reportsSent   map[string]uint64 // By playback event
+	reportsFailed map[string]uint64 // By playback event
+	lastSuccess   time.Time         // Time of the last report Jellyfin accepted
+	authRefreshes uint64
+	pollLatency   time.Duration // Duration of the last PotPlayer poll
+}
+
+// metrics is updated by the bridge and the client of the running instance
+var metrics = &Metrics{reportsSent: make(map[string]uint64), reportsFailed: make(map[string]uint64)}
+
+// RecordReport counts a playback report sent to Jellyfin
+func (m *Metrics) RecordReport(event string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.reportsFailed[event]++
+		return
+	}
+	m.reportsSent[event]++
+	m.lastSuccess = time.Now()
+}
+
+// RecordAuthRefresh counts a login done because Jellyfin rejected the token
+func (m *Metrics) RecordAuthRefresh() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authRefreshes++
+}
+
+// RecordPoll records how long asking PotPlayer for its state took
+func (m *Metrics) RecordPoll(latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pollLatency = latency
+}
+
+// Render writes the metrics and the playback status in the Prometheus text format
+// The text is formatted before writing so a slow scrape never holds m.mu, which playback reports also need
+func (m *Metrics) Render(w io.Writer, status BridgeStatus) error {
+	var buffer bytes.Buffer
+	m.format(&buffer, status)
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// format formats the metrics and the playback status into w
+func (m *Metrics) format(w io.Writer, status BridgeStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	writeByEvent := func(name, help string, counts map[string]uint64) {
+		writeHeader(name, "counter", help)
+		events := make([]string, 0, len(counts))
+		for event := range counts {
+			events = append(events, event)
+		}
+		slices.Sort(events)
+		for _, event := range events {
+			fmt.Fprintf(w, "%s{event=%q} %d\n", name, event, counts[event])
+		}
+	}
+
+	writeByEvent("jellypot_reports_sent_total", "Playback reports accepted by Jellyfin.", m.reportsSent)
+	writeByEvent("jellypot_reports_failed_total", "Playback reports that failed to reach Jellyfin.",
+		m.reportsFailed)
+	writeHeader("jellypot_last_report_success_timestamp_seconds", "gauge",
+		"Unix time of the last playback report accepted by Jellyfin, 0 before the first one.")
+	var lastSuccess float64
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = float64(m.lastSuccess.UnixMilli()) / 1000
+	}
+	fmt.Fprintf(w, "jellypot_last_report_success_timestamp_seconds %g\n", lastSuccess)
+	writeHeader("jellypot_auth_refreshes_total", "counter", "Logins done because Jellyfin rejected the token.")
+	fmt.Fprintf(w, "jellypot_auth_refreshes_total %d\n", m.authRefreshes)
+	writeHeader("jellypot_poll_latency_seconds", "gauge", "Duration of the last PotPlayer state poll.")
+	fmt.Fprintf(w, "jellypot_poll_latency_seconds %g\n", m.pollLatency.Seconds())
+
+	writeHeader("jellypot_position_seconds", "gauge", "Playback position of the current item.")
+	fmt.Fprintf(w, "jellypot_position_seconds %g\n", float64(status.PositionTicks)/TicksPerMillisecond/1000)
+	writeHeader("jellypot_runtime_seconds", "gauge", "Duration of the current item, 0 when unknown.")
+	fmt.Fprintf(w, "jellypot_runtime_seconds %g\n", float64(status.RunTimeTicks)/TicksPerMillisecond/1000)
+	writeHeader("jellypot_playback_state", "gauge", "1 for the current playback state, 0 for the others.")
+	for _, state := range []string{PlaybackStateIdle, PlaybackStatePlaying, PlaybackStatePaused,
+		PlaybackStateStopped} {
+		value := 0
+		if status.State == state {
+			value = 1
+		}
+		fmt.Fprintf(w, "jellypot_playback_state{state=%q} %d\n", state, value)
+	}
+}
+
+// StartMetricsServer serves GET /metrics in the Prometheus text format on address until ctx is done
+// Unlike the status server it may listen on any address, so a Prometheus server on another machine can scrape it
+func StartMetricsServer(ctx context.Context, address string, bridge *Bridge) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := metrics.Render(w, bridge.Status()); err != nil {
+			slog.Debug("failed to write metrics", "error", err)
+		}
+	})
+	return serveHTTP(ctx, "metrics server", address, mux)
+}
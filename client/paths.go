@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ConfigFileName is the name of the config file in every searched directory
+const ConfigFileName = "config.yaml"
+
+// configSearchPaths returns the config files to look for, in order of precedence:
+// the per-user config directory first, then the directory of the executable
+func configSearchPaths() []string {
+	var paths []string
+	if dir, err := userConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, ConfigFileName))
+	}
+	if exePath, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(exePath), ConfigFileName))
+	}
+	return paths
+}
+
+// configFilePath returns the config file given by --config or JELLYPOT_CONFIG, or else the first existing file
+// of configSearchPaths; when none exists, it returns where a new one is created
+func configFilePath() (string, error) {
+	if path := viper.GetString("config"); path != "" {
+		return filepath.Abs(path)
+	}
+	paths := configSearchPaths()
+	if len(paths) == 0 {
+		return "", errors.New("failed to find a config directory")
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return paths[0], nil
+}
+
+// configNotFoundError describes where the config file was looked for
+func configNotFoundError() error {
+	if path := viper.GetString("config"); path != "" {
+		return fmt.Errorf("config file %s does not exist", path)
+	}
+	return fmt.Errorf("no config file found, searched: %s", strings.Join(configSearchPaths(), ", "))
+}
+
+// dataDir returns the per-user, per-machine directory for device IDs, tokens and queued positions
+// It falls back to the directory of the executable rather than of the config file, which may roam between machines
+func dataDir() string {
+	if dir, err := userDataDir(); err == nil {
+		return dir
+	}
+	if exePath, err := os.Executable(); err == nil {
+		return filepath.Dir(exePath)
+	}
+	return "."
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RegisterProtocol registers a custom URL protocol to launch the current application
+// Protocol registration is only supported on Windows
+func RegisterProtocol(protocol, description string, args ...string) {
+	fmt.Printf("Registering the %s:// protocol is only supported on Windows\n", protocol)
+}
+
+// UnregisterProtocol removes a previously registered protocol from the system
+// Protocol registration is only supported on Windows
+func UnregisterProtocol(protocol string) {
+	fmt.Printf("Unregistering the %s:// protocol is only supported on Windows\n", protocol)
+}
+
+// ProtocolCommand returns the command registered to open links of a custom URL protocol
+// Protocol registration is only supported on Windows
+func ProtocolCommand(protocol string) (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+// userConfigDir returns the per-user config directory, $XDG_CONFIG_HOME/jellypotbridge
+func userConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jellypotbridge"), nil
+}
+
+// userDataDir returns the per-user data directory, $XDG_DATA_HOME/jellypotbridge
+func userDataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "jellypotbridge"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "jellypotbridge"), nil
+}
+
+// hideConsole hides the console window, which only exists on Windows
+func hideConsole() {}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// RegisterProtocol registers a custom URL protocol to launch the current application
+// protocol: The protocol name (e.g., "jellypot")
+// description: Human-readable description of the protocol
+// args: Extra arguments passed before the URL on every launch
+func RegisterProtocol(protocol, description string, args ...string) {
+	exePath, err := os.Executable()
+	if err != nil {
+		fmt.Printf("Failed to get executable path: %s", err.Error())
+		return
+	}
+	exePath, err = filepath.Abs(exePath)
+	if err != nil {
+		fmt.Printf("Failed to get absolute path: %s", err.Error())
+		return
+	}
+	fmt.Printf("Registering protocol '%s' with handler: %s\n", protocol, exePath)
+	key, _, err := registry.CreateKey(registry.CLASSES_ROOT, protocol, registry.ALL_ACCESS)
+	if err != nil {
+		fmt.Printf("Failed to create main protocol key: %s", err.Error())
+		return
+	}
+	defer func(key registry.Key) { _ = key.Close() }(key)
+	if err := key.SetStringValue("", "URL:"+description); err != nil {
+		fmt.Printf("Failed to set protocol description: %s", err.Error())
+		return
+	}
+	if err := key.SetStringValue("URL Protocol", ""); err != nil {
+		fmt.Printf("Failed to set URL Protocol indicator: %s", err.Error())
+		return
+	}
+	commandPath := fmt.Sprintf("%s\\shell\\open\\command", protocol)
+	cmdKey, _, err := registry.CreateKey(registry.CLASSES_ROOT, commandPath, registry.ALL_ACCESS)
+	if err != nil {
+		fmt.Printf("Failed to create command key: %s", err.Error())
+		return
+	}
+	defer func(cmdKey registry.Key) { _ = cmdKey.Close() }(cmdKey)
+	launchCommand := fmt.Sprintf(`"%s"`, exePath)
+	for _, arg := range args {
+		launchCommand += fmt.Sprintf(` "%s"`, arg)
+	}
+	launchCommand += ` "%1"`
+	if err := cmdKey.SetStringValue("", launchCommand); err != nil {
+		fmt.Printf("Failed to set launch command: %s", err.Error())
+		return
+	}
+	fmt.Printf("Successfully registered protocol: %s://\n", protocol)
+}
+
+// UnregisterProtocol removes a previously registered protocol from the system
+// protocol: The protocol name to unregister
+func UnregisterProtocol(protocol string) {
+	fmt.Printf("Unregistering protocol: %s\n", protocol)
+	if err := registry.DeleteKey(registry.CLASSES_ROOT, protocol); err != nil {
+		fmt.Printf("Failed to delete protocol registry keys: %s", err.Error())
+		return
+	}
+	fmt.Printf("Successfully unregistered protocol: %s://\n", protocol)
+}
+
+// ProtocolCommand returns the command registered to open links of a custom URL protocol
+func ProtocolCommand(protocol string) (string, error) {
+	key, err := registry.OpenKey(registry.CLASSES_ROOT, protocol+`\shell\open\command`, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer func(key registry.Key) { _ = key.Close() }(key)
+	command, _, err := key.GetStringValue("")
+	return command, err
+}
+
+// userConfigDir returns the per-user config directory, %APPDATA%\JellyPotBridge
+func userConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "JellyPotBridge"), nil
+}
+
+// userDataDir returns the per-user data directory, %LOCALAPPDATA%\JellyPotBridge
+func userDataDir() (string, error) {
+	dir := os.Getenv("LOCALAPPDATA")
+	if dir == "" {
+		return "", errors.New("%LOCALAPPDATA% is not defined")
+	}
+	return filepath.Join(dir, "JellyPotBridge"), nil
+}
+
+// hideConsole hides the console window
+func hideConsole() {
+	if hWnd, _, _ := syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleWindow").Call(); hWnd != 0 {
+		_, _, _ = syscall.NewLazyDLL("user32.dll").NewProc("ShowWindow").Call(hWnd, 0)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// knownPlayer describes where a media player is usually installed
+type knownPlayer struct {
+	Name        string
+	Executables []string // Executable names, preferred first
+	Directories []string // Install directories relative to Program Files
+	DisplayName string   // Prefix of the DisplayName in the uninstall registry keys
+}
+
+// KnownPlayers lists the players DetectPlayers looks for; PotPlayer comes first as the bridge controls it
+var KnownPlayers = []knownPlayer{
+	{
+		Name:        "PotPlayer",
+		Executables: []string{"PotPlayerMini64.exe", "PotPlayerMini.exe", "PotPlayer64.exe", "PotPlayer.exe"},
+		Directories: []string{`DAUM\PotPlayer`, `Kakao\PotPlayer`, "PotPlayer"},
+		DisplayName: "PotPlayer",
+	},
+	{
+		Name:        "mpv",
+		Executables: []string{"mpv.exe"},
+		Directories: []string{"mpv"},
+		DisplayName: "mpv",
+	},
+	{
+		Name:        "VLC",
+		Executables: []string{"vlc.exe"},
+		Directories: []string{`VideoLAN\VLC`},
+		DisplayName: "VLC media player",
+	},
+	{
+		Name:        "MPC-HC",
+		Executables: []string{"mpc-hc64.exe", "mpc-hc.exe"},
+		Directories: []string{"MPC-HC", `K-Lite Codec Pack\MPC-HC64`, `K-Lite Codec Pack\MPC-HC`},
+		DisplayName: "MPC-HC",
+	},
+}
+
+// DetectedPlayer is a media player found on this machine
+type DetectedPlayer struct {
+	Name   string
+	Path   string
+	Source string // Where the player was found
+}
+
+// DetectPlayers looks for the known players in the registry, the Program Files directories and PATH
+func DetectPlayers() []DetectedPlayer {
+	var players []DetectedPlayer
+	seen := make(map[string]bool)
+	add := func(name, path, source string) {
+		key := strings.ToLower(filepath.Clean(path))
+		if path == "" || seen[key] || !isExecutableFile(path) {
+			return
+		}
+		seen[key] = true
+		players = append(players, DetectedPlayer{Name: name, Path: path, Source: source})
+	}
+
+	for _, player := range KnownPlayers {
+		for _, found := range registryPlayerPaths(player) {
+			add(player.Name, found.Path, found.Source)
+		}
+		for _, dir := range programDirectories() {
+			for _, sub := range player.Directories {
+				for _, exe := range player.Executables {
+					add(player.Name, filepath.Join(dir, sub, exe), "Program Files")
+				}
+			}
+		}
+		for _, exe := range player.Executables {
+			// LookPath adds .exe back on Windows
+			if path, err := exec.LookPath(strings.TrimSuffix(exe, ".exe")); err == nil {
+				if path, err = filepath.Abs(path); err == nil {
+					add(player.Name, path, "PATH")
+				}
+			}
+		}
+	}
+	return players
+}
+
+// DetectPotPlayer returns the first PotPlayer found by DetectPlayers
+func DetectPotPlayer() (string, bool) {
+	for _, player := range DetectPlayers() {
+		if player.Name == KnownPlayers[0].Name {
+			return player.Path, true
+		}
+	}
+	return "", false
+}
+
+// useDetectedPlayer fills in an unset pot-player-path with the detected PotPlayer and reports whether it did
+func (c *JellyPotConfig) useDetectedPlayer() bool {
+	if path := strings.TrimSpace(c.PotPlayerPath); path != "" && path != SamplePlaceholder {
+		return false
+	}
+	detected, ok := DetectPotPlayer()
+	if ok {
+		c.PotPlayerPath = detected
+	}
+	return ok
+}
+
+// programDirectories returns the directories programs are installed in
+func programDirectories() []string {
+	var dirs []string
+	for _, name := range []string{"ProgramFiles", "ProgramFiles(x86)", "ProgramW6432"} {
+		if dir := os.Getenv(name); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+		dirs = append(dirs, filepath.Join(dir, "Programs"))
+	}
+	return dirs
+}
+
+// printDetectedPlayers lists detected players with a number to choose them by
+func printDetectedPlayers(players []DetectedPlayer) {
+	fmt.Printf("Found %d player(s):\n", len(players))
+	for i, player := range players {
+		fmt.Printf("  %d. %s - %s (%s)\n", i+1, player.Name, player.Path, player.Source)
+	}
+}
+
+// runDetectPlayers lists the installed players and prints how to configure the chosen one as pot-player-path
+func runDetectPlayers() error {
+	players := DetectPlayers()
+	if len(players) == 0 {
+		return errors.New("no player found")
+	}
+	printDetectedPlayers(players)
+	if !canRunWizard() {
+		return nil
+	}
+
+	line := promptLine(fmt.Sprintf("Choose a player to use as pot-player-path (1-%d), or press Enter to skip",
+		len(players)), "")
+	i, err := strconv.Atoi(line)
+	if line == "" || err != nil || i < 1 || i > len(players) {
+		return nil
+	}
+	if _, err := readConfig(); err != nil {
+		fmt.Printf("Set pot-player-path to %s in config.yaml\n", players[i-1].Path)
+		return err
+	}
+	printConfigHint("pot-player-path", players[i-1].Path)
+	return nil
+}
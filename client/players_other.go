@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// registryPlayerPaths looks a player up in the registry, which only exists on Windows
+func registryPlayerPaths(player knownPlayer) []DetectedPlayer {
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// Registry keys listing installed programs, for both 64-bit and 32-bit installs
+var uninstallKeys = []string{
+	`SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`,
+	`SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`,
+}
+
+// registryPlayerPaths looks a player up in the App Paths and uninstall registry keys
+func registryPlayerPaths(player knownPlayer) []DetectedPlayer {
+	var found []DetectedPlayer
+	roots := []registry.Key{registry.CURRENT_USER, registry.LOCAL_MACHINE}
+
+	for _, root := range roots {
+		for _, exe := range player.Executables {
+			key, err := registry.OpenKey(root, `SOFTWARE\Microsoft\Windows\CurrentVersion\App Paths\`+exe,
+				registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			path, _, err := key.GetStringValue("")
+			_ = key.Close()
+			if err == nil {
+				found = append(found, DetectedPlayer{Name: player.Name, Path: strings.Trim(path, `"`),
+					Source: "registry App Paths"})
+			}
+		}
+	}
+
+	for _, root := range roots {
+		for _, uninstallKey := range uninstallKeys {
+			for _, dir := range uninstallLocations(root, uninstallKey, player.DisplayName) {
+				for _, exe := range player.Executables {
+					found = append(found, DetectedPlayer{Name: player.Name, Path: filepath.Join(dir, exe),
+						Source: "registry uninstall key"})
+				}
+			}
+		}
+	}
+	return found
+}
+
+// uninstallLocations returns the install directories of the programs whose DisplayName starts with displayName
+func uninstallLocations(root registry.Key, path, displayName string) []string {
+	key, err := registry.OpenKey(root, path, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil
+	}
+	defer func(key registry.Key) { _ = key.Close() }(key)
+	names, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for _, name := range names {
+		sub, err := registry.OpenKey(key, name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		value, _, err := sub.GetStringValue("DisplayName")
+		if err == nil && strings.HasPrefix(strings.ToLower(value), strings.ToLower(displayName)) {
+			if location, _, err := sub.GetStringValue("InstallLocation"); err == nil && location != "" {
+				dirs = append(dirs, strings.Trim(location, `"`))
+			} else if icon, _, err := sub.GetStringValue("DisplayIcon"); err == nil && icon != "" {
+				// DisplayIcon is "path\player.exe,0"
+				icon = strings.Trim(strings.SplitN(icon, ",", 2)[0], `"`)
+				dirs = append(dirs, filepath.Dir(icon))
+			}
+		}
+		_ = sub.Close()
+	}
+	return dirs
+}
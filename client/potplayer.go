@@ -0,0 +1,131 @@
+package main
+
+// Windows message constants for PotPlayer communication
+const (
+	WmUser              = 0x0400
+	WmClose             = 0x0010
+	PotGetVolume        = 0x5000 // Message to get the volume (0-100)
+	PotSetVolume        = 0x5001 // Message to set the volume (0-100)
+	PotGetTotalTime     = 0x5002 // Message to get total duration in milliseconds
+	PotGetCurrentTime   = 0x5004 // Message to get current playback time
+	PotSetCurrentTime   = 0x5005 // Message to seek to a playback time in milliseconds
+	PotGetPlayStatus    = 0x5006 // Message to get playback status
+	PotSetPlayStatus    = 0x5007 // Message to set playback status
+	PotSetPlayOrder     = 0x5008 // Message to skip within the PotPlayer playlist
+	PotSetPlayClose     = 0x5009 // Message to close the current media
+	TicksPerMillisecond = 10000  // Conversion factor for ticks
+)
+
+// Parameters for PotSetPlayStatus and PotSetPlayOrder
+const (
+	PotPlayStatusToggle  = 0
+	PotPlayStatusPause   = 1
+	PotPlayStatusPlay    = 2
+	PotPlayOrderPrevious = 0
+	PotPlayOrderNext     = 1
+)
+
+// PotPlayerClassNames contains possible window class names for PotPlayer
+var PotPlayerClassNames = []string{
+	"PotPlayer64",     // 64-bit default class name
+	"PotPlayer",       // 32-bit default class name
+	"PotPlayerMini64", // 64-bit mini mode class name
+	"PotPlayerMini",   // 32-bit mini mode class name
+}
+
+// PotPlayerInfo holds playback information from PotPlayer
+type PotPlayerInfo struct {
+	HWnd         uintptr
+	Status       int
+	EventName    string
+	Milliseconds uintptr
+	Seconds      float64
+	Ticks        int64
+	Duration     uintptr // Total duration in milliseconds, 0 when unknown
+	RunTimeTicks int64   // Total duration in ticks, 0 when unknown
+}
+
+// PotPlayer controls a running PotPlayer instance through its WM_USER message API
+type PotPlayer struct{}
+
+// NewPotPlayer creates a new PotPlayer controller
+func NewPotPlayer() *PotPlayer {
+	return &PotPlayer{}
+}
+
+// Info retrieves current playback information
+func (p *PotPlayer) Info() (*PotPlayerInfo, error) {
+	return getPotPlayerInfo()
+}
+
+// TogglePause toggles between playing and paused
+func (p *PotPlayer) TogglePause() error {
+	_, err := p.send(PotSetPlayStatus, PotPlayStatusToggle)
+	return err
+}
+
+// Pause pauses playback
+func (p *PotPlayer) Pause() error {
+	_, err := p.send(PotSetPlayStatus, PotPlayStatusPause)
+	return err
+}
+
+// Resume resumes paused playback
+func (p *PotPlayer) Resume() error {
+	_, err := p.send(PotSetPlayStatus, PotPlayStatusPlay)
+	return err
+}
+
+// SeekTo jumps to the given position in ticks
+func (p *PotPlayer) SeekTo(positionTicks int64) error {
+	if positionTicks < 0 {
+		positionTicks = 0
+	}
+	_, err := p.send(PotSetCurrentTime, uintptr(positionTicks/TicksPerMillisecond))
+	return err
+}
+
+// Stop closes the current media but keeps PotPlayer open
+func (p *PotPlayer) Stop() error {
+	_, err := p.send(PotSetPlayClose, 0)
+	return err
+}
+
+// Next skips to the next entry in the PotPlayer playlist
+func (p *PotPlayer) Next() error {
+	_, err := p.send(PotSetPlayOrder, PotPlayOrderNext)
+	return err
+}
+
+// Previous skips to the previous entry in the PotPlayer playlist
+func (p *PotPlayer) Previous() error {
+	_, err := p.send(PotSetPlayOrder, PotPlayOrderPrevious)
+	return err
+}
+
+// Volume returns the current volume (0-100)
+func (p *PotPlayer) Volume() (int, error) {
+	volume, err := p.send(PotGetVolume, 0)
+	return int(volume), err
+}
+
+// SetVolume sets the volume, clamped to 0-100
+func (p *PotPlayer) SetVolume(volume int) error {
+	volume = max(0, min(volume, 100))
+	_, err := p.send(PotSetVolume, uintptr(volume))
+	return err
+}
+
+// getEventName maps PotPlayer status codes to Jellyfin event names
+func getEventName(status int) string {
+	switch status {
+	case 2:
+		return "timeupdate"
+	case 1:
+		return "pause"
+	case -1:
+		return "stop"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// errPotPlayerUnsupported is returned by PotPlayer operations outside Windows
+var errPotPlayerUnsupported = errors.New("PotPlayer control is only supported on Windows")
+
+// getPotPlayerInfo retrieves current playback information from PotPlayer
+func getPotPlayerInfo() (*PotPlayerInfo, error) {
+	return nil, errPotPlayerUnsupported
+}
+
+// send delivers a WM_USER command with a parameter to the PotPlayer window
+func (p *PotPlayer) send(command, param uintptr) (uintptr, error) {
+	return 0, errPotPlayerUnsupported
+}
+
+// Close asks the PotPlayer window to close
+func (p *PotPlayer) Close() error {
+	return errPotPlayerUnsupported
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	user32            = syscall.NewLazyDLL("user32.dll")
+	procGetClassNameW = user32.NewProc("GetClassNameW")
+)
+
+// GetClassNameW retrieves the class name of a window
+func GetClassNameW(hWnd syscall.Handle, className *uint16, nMaxCount int32) int32 {
+	r1, _, _ := syscall.SyscallN(procGetClassNameW.Addr(),
+		uintptr(hWnd),
+		uintptr(unsafe.Pointer(className)),
+		uintptr(nMaxCount))
+	return int32(r1)
+}
+
+// findPotPlayerWindow locates the PotPlayer window using its class names
+func findPotPlayerWindow() (uintptr, error) {
+	// First try FindWindow with known class names
+	for _, class := range PotPlayerClassNames {
+		utf16Class, err := syscall.UTF16PtrFromString(class)
+		if err != nil {
+			return 0, fmt.Errorf("failed to convert class name: %w", err)
+		}
+
+		hWnd, _, err := user32.NewProc("FindWindowW").Call(uintptr(unsafe.Pointer(utf16Class)), 0)
+
+		if hWnd != 0 && errors.Is(err, syscall.Errno(0)) {
+			return hWnd, nil
+		}
+	}
+
+	// If not found, enumerate all windows
+	var hWnd uintptr
+	cb := syscall.NewCallback(func(h syscall.Handle, l uintptr) uintptr {
+		var className [256]uint16
+		GetClassNameW(h, &className[0], int32(len(className)))
+		classNameStr := syscall.UTF16ToString(className[:])
+
+		for _, c := range PotPlayerClassNames {
+			if classNameStr == c {
+				hWnd = uintptr(h)
+				return 0 // Stop enumeration
+			}
+		}
+		return 1 // Continue enumeration
+	})
+
+	_, _, _ = user32.NewProc("EnumWindows").Call(cb, 0)
+
+	if hWnd != 0 {
+		return hWnd, nil
+	}
+
+	return 0, fmt.Errorf("PotPlayer window not found")
+}
+
+// getPotPlayerInfo retrieves current playback information from PotPlayer
+func getPotPlayerInfo() (*PotPlayerInfo, error) {
+	hWnd, err := findPotPlayerWindow()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find PotPlayer window: %w", err)
+	}
+	sendMessage := user32.NewProc("SendMessageW")
+	if sendMessage.Find() != nil {
+		return nil, fmt.Errorf("failed to get SendMessageW procedure")
+	}
+
+	// Get playback status
+	status, _, _ := sendMessage.Call(hWnd, uintptr(WmUser), uintptr(PotGetPlayStatus), 0)
+	// Get current playback time in milliseconds
+	milliseconds, _, _ := sendMessage.Call(hWnd, uintptr(WmUser), uintptr(PotGetCurrentTime), 0)
+	// Get total duration in milliseconds
+	duration, _, _ := sendMessage.Call(hWnd, uintptr(WmUser), uintptr(PotGetTotalTime), 0)
+	seconds := float64(milliseconds) / 1000.0
+	ticks := int64(milliseconds) * TicksPerMillisecond
+	eventName := getEventName(int(status))
+
+	return &PotPlayerInfo{
+		HWnd:         hWnd,
+		Status:       int(status),
+		EventName:    eventName,
+		Milliseconds: milliseconds,
+		Seconds:      seconds,
+		Ticks:        ticks,
+		Duration:     duration,
+		RunTimeTicks: int64(duration) * TicksPerMillisecond,
+	}, nil
+}
+
+// Close asks the PotPlayer window to close
+func (p *PotPlayer) Close() error {
+	hWnd, err := findPotPlayerWindow()
+	if err != nil {
+		return fmt.Errorf("failed to find PotPlayer window: %w", err)
+	}
+	_, _, _ = user32.NewProc("PostMessageW").Call(hWnd, uintptr(WmClose), 0, 0)
+	return nil
+}
+
+// send delivers a WM_USER command with a parameter to the PotPlayer window
+func (p *PotPlayer) send(command, param uintptr) (uintptr, error) {
+	hWnd, err := findPotPlayerWindow()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find PotPlayer window: %w", err)
+	}
+	result, _, _ := user32.NewProc("SendMessageW").Call(hWnd, uintptr(WmUser), command, param)
+	return result, nil
+}
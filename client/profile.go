@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// LegacyProfileName is the profile name given to the single jellyfin section of older config files
+const LegacyProfileName = "default"
+
+// normalizeProfiles merges the legacy jellyfin section into the servers map
+func (c *JellyPotConfig) normalizeProfiles() {
+	if c.Servers == nil {
+		c.Servers = make(map[string]JellyfinConfig)
+	}
+	if _, ok := c.Servers[LegacyProfileName]; !ok && len(c.Jellyfin.urls()) > 0 {
+		c.Servers[LegacyProfileName] = c.Jellyfin
+		c.legacyProfile = true
+	}
+}
+
+// addDefaultProfile adds the legacy jellyfin section as the default profile even without a server URL,
+// which discovery fills in
+func (c *JellyPotConfig) addDefaultProfile() {
+	c.normalizeProfiles()
+	if _, ok := c.Servers[LegacyProfileName]; !ok {
+		c.Servers[LegacyProfileName] = c.Jellyfin
+		c.legacyProfile = true
+	}
+}
+
+// profileNames returns the configured profile names in sorted order
+func (c *JellyPotConfig) profileNames() []string {
+	names := make([]string, 0, len(c.Servers))
+	for name := range c.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveProfile finds the profile named by selector, which may also be the server URL of a profile
+// An empty selector, or a URL matching no profile, picks default-server or the only profile
+func (c *JellyPotConfig) resolveProfile(selector string) (string, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		selector = c.DefaultServer
+	}
+	if selector == "" {
+		switch len(c.Servers) {
+		case 0:
+			return "", errors.New("no server profile is configured")
+		case 1:
+			return c.profileNames()[0], nil
+		}
+		if _, ok := c.Servers[LegacyProfileName]; ok {
+			return LegacyProfileName, nil
+		}
+		return "", fmt.Errorf("default-server is not set, choose one of: %s", strings.Join(c.profileNames(), ", "))
+	}
+
+	// Viper lower-cases map keys, so names are matched case-insensitively
+	if _, ok := c.Servers[strings.ToLower(selector)]; ok {
+		return strings.ToLower(selector), nil
+	}
+	for _, name := range c.profileNames() {
+		for _, u := range c.Servers[name].urls() {
+			if sameServerUrl(u, selector) {
+				return name, nil
+			}
+		}
+	}
+	if strings.Contains(selector, "://") && selector != c.DefaultServer {
+		// The web client may be opened through an address that is not configured
+		return c.resolveProfile("")
+	}
+	return "", fmt.Errorf("unknown server profile %q, choose one of: %s", selector, strings.Join(c.profileNames(), ", "))
+}
+
+// selectProfile applies the profile named by selector, including its player settings
+func (c *JellyPotConfig) selectProfile(selector string) error {
+	name, err := c.resolveProfile(selector)
+	if err != nil {
+		return err
+	}
+
+	profile := c.Servers[name]
+	c.profile = name
+	c.profileKey = "servers." + name
+	if name == LegacyProfileName && c.legacyProfile {
+		c.profileKey = "jellyfin"
+	}
+	c.Jellyfin = profile
+	if profile.PotPlayerPath != "" {
+		c.PotPlayerPath = profile.PotPlayerPath
+	}
+	if profile.ClosePlayerOnExit != nil {
+		c.ClosePlayerOnExit = *profile.ClosePlayerOnExit
+	}
+	if len(profile.LaunchArgs) > 0 {
+		c.LaunchArgs = profile.LaunchArgs
+	}
+	return nil
+}
+
+// setupProfile selects the profile named by selector, or by the profile flag when selector is empty,
+// and applies the flag and environment overrides to it
+// It reports whether the player path was detected because none is configured
+func (c *JellyPotConfig) setupProfile(selector string) (bool, error) {
+	if selector == "" {
+		selector = viper.GetString("profile")
+	}
+	if err := c.selectProfile(selector); err != nil {
+		return false, err
+	}
+	c.applyOverrides()
+	return c.useDetectedPlayer(), nil
+}
+
+// serverUrlKey returns the config key of the server URL of the default profile
+func (c *JellyPotConfig) serverUrlKey() string {
+	if name, err := c.resolveProfile(""); err == nil && (name != LegacyProfileName || !c.legacyProfile) {
+		return "servers." + name + ".server-url"
+	}
+	return "jellyfin.server-url"
+}
+
+// applyOverrides applies the server and player given by flags or environment variables to the selected profile
+func (c *JellyPotConfig) applyOverrides() {
+	if server := viper.GetString("server"); server != "" {
+		c.Jellyfin.ServerUrl = server
+		c.Jellyfin.ServerUrls = nil
+	}
+	if player := viper.GetString("player"); player != "" {
+		c.PotPlayerPath = player
+	}
+}
+
+// matchesProfile reports whether selector names the selected profile
+func (c *JellyPotConfig) matchesProfile(selector string) bool {
+	if strings.TrimSpace(selector) == "" {
+		return true
+	}
+	name, err := c.resolveProfile(selector)
+	return err == nil && name == c.profile
+}
+
+// DataPath returns the path of a file kept separately for the selected profile in the per-user data directory
+func (c *JellyPotConfig) DataPath(name string) string {
+	return filepath.Join(dataDir(), "profiles", safeFileName(c.profile), name)
+}
+
+// urls returns the configured server addresses, server-url first
+func (j JellyfinConfig) urls() []string {
+	var urls []string
+	for _, u := range append([]string{j.ServerUrl}, j.ServerUrls...) {
+		if strings.TrimSpace(u) != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// sameServerUrl compares two server URLs, ignoring case and trailing slashes
+func sameServerUrl(a, b string) bool {
+	a = strings.TrimRight(strings.TrimSpace(a), "/")
+	b = strings.TrimRight(strings.TrimSpace(b), "/")
+	return a != "" && strings.EqualFold(a, b)
+}
+
+// safeFileName replaces characters that are not allowed in file names on every platform
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ProgressQueue persists the last unsent playback position per item until Jellyfin is reachable again
+type ProgressQueue struct {
+	path string
+
+	mu     sync.Mutex
+	events map[string]PlaybackStatusEvent
+}
+
+// NewProgressQueue creates a ProgressQueue stored at path, loading positions left by earlier runs
+func NewProgressQueue(path string) *ProgressQueue {
+	q := &ProgressQueue{
+		path:   path,
+		events: make(map[string]PlaybackStatusEvent),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to read progress queue", "path", path, "error", err)
+		}
+		return q
+	}
+	if err := json.Unmarshal(data, &q.events); err != nil {
+		slog.Warn("failed to parse progress queue", "path", path, "error", err)
+	}
+	return q
+}
+
+// Put records the latest position of an item, replacing any older one
+func (q *ProgressQueue) Put(event PlaybackStatusEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events[event.ItemId] = event
+	q.saveLocked()
+}
+
+// Remove forgets the queued position of an item
+func (q *ProgressQueue) Remove(itemId string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.events[itemId]; !ok {
+		return
+	}
+	delete(q.events, itemId)
+	q.saveLocked()
+}
+
+// Len returns the number of queued items
+func (q *ProgressQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.events)
+}
+
+// Flush reports every queued position except skipItemId as stopped playback and drops the ones sent
+// The ones that fail stay queued for the next attempt
+func (q *ProgressQueue) Flush(ctx context.Context, client *JellyPotClient, skipItemId string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for itemId, event := range q.events {
+		if itemId == skipItemId {
+			continue
+		}
+		// The play session is long gone, so only the position and item matter
+		event.SessionId = ""
+		event.EventName = "stop"
+		if err := client.ReportPlaybackStopped(ctx, event); err != nil {
+			slog.Warn("failed to send queued position", "item_id", itemId, "event", event.EventName,
+				"status", statusCode(err), "error", err)
+			continue
+		}
+		slog.Info("sent queued position", "item_id", itemId, "event", event.EventName,
+			"position_ticks", event.PositionTicks)
+		delete(q.events, itemId)
+	}
+	q.saveLocked()
+}
+
+// saveLocked writes the queue to disk, removing the file when empty; q.mu must be held
+func (q *ProgressQueue) saveLocked() {
+	if len(q.events) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to remove progress queue", "path", q.path, "error", err)
+		}
+		return
+	}
+
+	data, err := json.MarshalIndent(q.events, "", "  ")
+	if err != nil {
+		slog.Warn("failed to encode progress queue", "error", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		slog.Warn("failed to save progress queue", "path", q.path, "error", err)
+		return
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		slog.Warn("failed to save progress queue", "path", q.path, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		slog.Warn("failed to save progress queue", "path", q.path, "error", err)
+	}
+}
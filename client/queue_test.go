@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestQueuedPositionSentAfterRecovery checks that a position queued while Jellyfin was down is sent
+// once it is back, without any further playback
+func TestQueuedPositionSentAfterRecovery(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	stopped := make(chan PlaybackStatusEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/Sessions/Playing/Stopped" {
+			var event PlaybackStatusEvent
+			_ = json.NewDecoder(r.Body).Decode(&event)
+			stopped <- event
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewJellyPotClient(server.URL, "user", "password", "device")
+	client.setAuthState("token", "session", "user")
+	client.retry = RetryPolicy{Attempts: 1}
+	pending := NewProgressQueue(filepath.Join(t.TempDir(), "progress-queue.json"))
+	bridge := NewBridge(&JellyPotConfig{profile: "default"}, client, pending)
+
+	// Playback ends while the server is down
+	bridge.mu.Lock()
+	bridge.current = &PlaybackTarget{Item: &MediaItem{Id: "item"}, PositionTicks: 42 * TicksPerMillisecond * 1000}
+	bridge.reportStoppedLocked(context.Background())
+	bridge.unlock()
+	if n := pending.Len(); n != 1 {
+		t.Fatalf("queued items = %d, want 1", n)
+	}
+
+	bridge.flushPending(context.Background())
+	if n := pending.Len(); n != 1 {
+		t.Fatalf("queued items while down = %d, want 1", n)
+	}
+
+	down.Store(false)
+	bridge.flushPending(context.Background())
+	select {
+	case event := <-stopped:
+		if event.ItemId != "item" || event.PositionTicks != 42*TicksPerMillisecond*1000 {
+			t.Errorf("sent %s at %d, want item at %d", event.ItemId, event.PositionTicks,
+				42*TicksPerMillisecond*1000)
+		}
+	default:
+		t.Fatal("queued position was not sent after the server recovered")
+	}
+	if n := pending.Len(); n != 0 {
+		t.Errorf("queued items after recovery = %d, want 0", n)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// QuickConnectState is a pending Quick Connect request as reported by Jellyfin
+type QuickConnectState struct {
+	Secret        string `json:"Secret"`
+	Code          string `json:"Code"`
+	Authenticated bool   `json:"Authenticated"`
+}
+
+// QuickConnectPollInterval is how often a pending Quick Connect request is checked
+const QuickConnectPollInterval = 3 * time.Second
+
+// InitiateQuickConnect starts a Quick Connect request; the returned code is entered in another logged-in client
+func (c *JellyPotClient) InitiateQuickConnect(ctx context.Context) (*QuickConnectState, error) {
+	var state QuickConnectState
+	if err := c.doOnce(ctx, "initiate Quick Connect", "POST", "/QuickConnect/Initiate", nil, &state); err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			return nil, errors.New("Quick Connect is disabled on the server")
+		}
+		return nil, err
+	}
+	return &state, nil
+}
+
+// GetQuickConnectState retrieves the state of a pending Quick Connect request
+func (c *JellyPotClient) GetQuickConnectState(ctx context.Context, secret string) (*QuickConnectState, error) {
+	var state QuickConnectState
+	path := "/QuickConnect/Connect?secret=" + url.QueryEscape(secret)
+	if err := c.doOnce(ctx, "get Quick Connect state", "GET", path, nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// AuthenticateWithQuickConnect logs in with an approved Quick Connect request
+func (c *JellyPotClient) AuthenticateWithQuickConnect(ctx context.Context, secret string) error {
+	type quickConnectRequest struct {
+		Secret string `json:"Secret"`
+	}
+
+	type authResponse struct {
+		AccessToken string      `json:"AccessToken"`
+		SessionInfo SessionInfo `json:"SessionInfo"`
+	}
+
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	var authResp authResponse
+	err := c.send(ctx, "", "Quick Connect authentication", "POST", "/Users/AuthenticateWithQuickConnect",
+		quickConnectRequest{Secret: secret}, &authResp)
+	if err != nil {
+		return err
+	}
+
+	c.username = authResp.SessionInfo.UserName
+	c.setAuthState(authResp.AccessToken, authResp.SessionInfo.Id, authResp.SessionInfo.UserId)
+	c.saveToken()
+	return nil
+}
+
+// waitForQuickConnect polls a Quick Connect request until it is approved or ctx is done
+func (c *JellyPotClient) waitForQuickConnect(ctx context.Context, secret string) error {
+	ticker := time.NewTicker(QuickConnectPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		state, err := c.GetQuickConnectState(ctx, secret)
+		if err != nil {
+			return fmt.Errorf("failed to check Quick Connect request: %w", err)
+		}
+		if state.Authenticated {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// ConfigReloadDelay lets an editor finish writing the config file before it is parsed again
+const ConfigReloadDelay = 500 * time.Millisecond
+
+// watchConfig reloads the config file whenever it changes
+// Settings the bridge can change while running are applied at once, the others are reported
+// and take effect on the next launch
+func watchConfig(running *JellyPotConfig, bridge *Bridge) {
+	// Snapshot of what the session was started with, as bridge.ApplyConfig updates running in place
+	started := *running
+	path := viper.ConfigFileUsed()
+	reload := func() {
+		config, err := reloadConfig(path, started.profile)
+		if err != nil {
+			slog.Warn("ignoring changed config file", "path", path, "error", err)
+			return
+		}
+		bridge.ApplyConfig(config)
+		for _, key := range restartRequired(&started, config) {
+			slog.Info("changed setting applies on the next launch", "key", key)
+		}
+	}
+
+	// The watcher re-reads the file on its own instance, so the global one stays as it was at startup
+	watcher := newConfigViper(path)
+	if err := watcher.ReadInConfig(); err != nil {
+		slog.Warn("failed to watch the config file", "path", path, "error", err)
+		return
+	}
+	var mu sync.Mutex
+	var timer *time.Timer
+	watcher.OnConfigChange(func(e fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(ConfigReloadDelay, reload)
+	})
+	watcher.WatchConfig()
+}
+
+// newConfigViper returns a viper instance reading the config file at path with the environment overrides
+func newConfigViper(path string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	bindConfigEnv(v)
+	return v
+}
+
+// reloadConfig parses the config file at path again and selects the running profile
+func reloadConfig(path, profile string) (*JellyPotConfig, error) {
+	v := newConfigViper(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	config, err := parseConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := config.setupProfile(profile); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// restartRequired lists the keys that differ between the running and the reloaded profile
+// but cannot be applied to the running session
+func restartRequired(running, config *JellyPotConfig) []string {
+	var keys []string
+	prefix := running.profileKey + "."
+	if config.Jellyfin.ServerUrl != running.Jellyfin.ServerUrl {
+		keys = append(keys, prefix+"server-url")
+	}
+	if !slices.Equal(config.Jellyfin.ServerUrls, running.Jellyfin.ServerUrls) {
+		keys = append(keys, prefix+"server-urls")
+	}
+	if config.Jellyfin.Username != running.Jellyfin.Username {
+		keys = append(keys, prefix+"username")
+	}
+	if config.Jellyfin.Password != running.Jellyfin.Password {
+		keys = append(keys, prefix+"password")
+	}
+	// An empty device ID is generated once and saved, so it only matters when set to another value
+	if config.Jellyfin.DeviceId != "" && config.Jellyfin.DeviceId != running.Jellyfin.DeviceId {
+		keys = append(keys, prefix+"device-id")
+	}
+	if config.StatusAddress != running.StatusAddress {
+		keys = append(keys, "status-address")
+	}
+	if config.MetricsAddress != running.MetricsAddress {
+		keys = append(keys, "metrics-address")
+	}
+	if config.DefaultServer != running.DefaultServer {
+		keys = append(keys, "default-server")
+	}
+	return keys
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// RemoteCommandHandler applies remote control commands sent through the Jellyfin session
+type RemoteCommandHandler interface {
+	HandlePlaystate(ctx context.Context, request PlaystateRequest) error
+	HandlePlay(ctx context.Context, request PlayRequest) error
+	HandleGeneralCommand(ctx context.Context, request GeneralCommandRequest) error
+}
+
+// SupportedGeneralCommands lists the general commands RemoteCommandHandler implementations accept
+var SupportedGeneralCommands = []string{"SetVolume", "VolumeUp", "VolumeDown"}
+
+// PlaystateRequest represents a Playstate command from Jellyfin
+type PlaystateRequest struct {
+	Command           string `json:"Command"`
+	SeekPositionTicks int64  `json:"SeekPositionTicks"`
+	ControllingUserId string `json:"ControllingUserId"`
+}
+
+// PlayRequest represents a Play command from Jellyfin
+type PlayRequest struct {
+	ItemIds            []string `json:"ItemIds"`
+	StartPositionTicks int64    `json:"StartPositionTicks"`
+	PlayCommand        string   `json:"PlayCommand"`
+	StartIndex         int      `json:"StartIndex"`
+	ControllingUserId  string   `json:"ControllingUserId"`
+}
+
+// GeneralCommandRequest represents a general command from Jellyfin
+type GeneralCommandRequest struct {
+	Name              string            `json:"Name"`
+	Arguments         map[string]string `json:"Arguments"`
+	ControllingUserId string            `json:"ControllingUserId"`
+}
+
+// socketMessage is the envelope of every message on the Jellyfin WebSocket
+type socketMessage struct {
+	MessageType string          `json:"MessageType"`
+	MessageId   string          `json:"MessageId,omitempty"`
+	Data        json.RawMessage `json:"Data,omitempty"`
+}
+
+// RemoteSession keeps a WebSocket connection to the Jellyfin session open and dispatches commands
+type RemoteSession struct {
+	client         *JellyPotClient
+	handler        RemoteCommandHandler
+	dialer         *websocket.Dialer
+	reconnectDelay time.Duration
+}
+
+// NewRemoteSession creates a new RemoteSession for the given client and handler
+func NewRemoteSession(client *JellyPotClient, handler RemoteCommandHandler) *RemoteSession {
+	return &RemoteSession{
+		client:         client,
+		handler:        handler,
+		dialer:         &websocket.Dialer{HandshakeTimeout: 10 * time.Second},
+		reconnectDelay: 5 * time.Second,
+	}
+}
+
+// Run connects to the Jellyfin WebSocket and reconnects whenever the connection drops, until ctx is cancelled
+func (s *RemoteSession) Run(ctx context.Context) {
+	for {
+		if err := s.serve(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("remote control connection lost", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.reconnectDelay):
+		}
+	}
+}
+
+// serve handles a single WebSocket connection until it fails or ctx is cancelled
+func (s *RemoteSession) serve(ctx context.Context) error {
+	if err := s.client.ensureAuthenticated(ctx); err != nil {
+		return err
+	}
+	token := s.client.token()
+	socketUrl, err := s.client.socketUrl(token)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", s.client.authorizationHeader(token))
+	conn, resp, err := s.dialer.DialContext(ctx, socketUrl, header)
+	if err != nil {
+		if resp == nil {
+			// No answer at all, the address may be unreachable from this network
+			s.client.failover(ctx)
+		} else if resp.StatusCode == http.StatusUnauthorized {
+			// Refresh the token so the next attempt can connect
+			if authErr := s.client.reauthenticate(ctx, token); authErr != nil {
+				return authErr
+			}
+		}
+		return fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+	defer func(conn *websocket.Conn) { _ = conn.Close() }(conn)
+	slog.Info("remote control connected")
+
+	keepAlive := make(chan time.Duration, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go s.keepAlive(conn, keepAlive, done)
+	go func() {
+		// Unblock ReadJSON when shutting down
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		var msg socketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+
+		switch msg.MessageType {
+		case "ForceKeepAlive":
+			var seconds int
+			if err := json.Unmarshal(msg.Data, &seconds); err == nil && seconds > 0 {
+				select {
+				case keepAlive <- time.Duration(seconds) * time.Second / 2:
+				default:
+				}
+			}
+		case "Playstate":
+			var request PlaystateRequest
+			if err := json.Unmarshal(msg.Data, &request); err != nil {
+				slog.Warn("failed to parse remote command", "type", msg.MessageType, "error", err)
+				continue
+			}
+			slog.Info("remote command", "command", request.Command)
+			if err := s.handler.HandlePlaystate(ctx, request); err != nil {
+				slog.Error("failed to apply remote command", "command", request.Command, "error", err)
+			}
+		case "Play":
+			var request PlayRequest
+			if err := json.Unmarshal(msg.Data, &request); err != nil {
+				slog.Warn("failed to parse remote command", "type", msg.MessageType, "error", err)
+				continue
+			}
+			slog.Info("remote play", "command", request.PlayCommand, "item_ids", request.ItemIds)
+			if err := s.handler.HandlePlay(ctx, request); err != nil {
+				slog.Error("failed to apply remote play", "command", request.PlayCommand, "item_ids", request.ItemIds,
+					"error", err)
+			}
+		case "GeneralCommand":
+			var request GeneralCommandRequest
+			if err := json.Unmarshal(msg.Data, &request); err != nil {
+				slog.Warn("failed to parse remote command", "type", msg.MessageType, "error", err)
+				continue
+			}
+			slog.Info("remote command", "command", request.Name)
+			if err := s.handler.HandleGeneralCommand(ctx, request); err != nil {
+				slog.Error("failed to apply remote command", "command", request.Name, "error", err)
+			}
+		}
+	}
+}
+
+// keepAlive sends KeepAlive messages at the interval requested by the server
+func (s *RemoteSession) keepAlive(conn *websocket.Conn, interval <-chan time.Duration, done <-chan struct{}) {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case d := <-interval:
+			if ticker != nil {
+				ticker.Stop()
+			}
+			ticker = time.NewTicker(d)
+			tick = ticker.C
+		case <-tick:
+			if err := conn.WriteJSON(socketMessage{MessageType: "KeepAlive"}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// socketUrl builds the WebSocket URL of the Jellyfin session endpoint for the given access token
+func (c *JellyPotClient) socketUrl(token string) (string, error) {
+	u, err := url.Parse(c.ServerUrl())
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/socket"
+
+	query := url.Values{}
+	query.Set("api_key", token)
+	query.Set("deviceId", c.deviceId)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeRemoteHandler records the commands a RemoteSession dispatches
+type fakeRemoteHandler struct {
+	playstate chan PlaystateRequest
+	play      chan PlayRequest
+	general   chan GeneralCommandRequest
+}
+
+func newFakeRemoteHandler() *fakeRemoteHandler {
+	return &fakeRemoteHandler{
+		playstate: make(chan PlaystateRequest, 1),
+		play:      make(chan PlayRequest, 1),
+		general:   make(chan GeneralCommandRequest, 1),
+	}
+}
+
+func (h *fakeRemoteHandler) HandlePlaystate(ctx context.Context, request PlaystateRequest) error {
+	h.playstate <- request
+	return nil
+}
+
+func (h *fakeRemoteHandler) HandlePlay(ctx context.Context, request PlayRequest) error {
+	h.play <- request
+	return nil
+}
+
+func (h *fakeRemoteHandler) HandleGeneralCommand(ctx context.Context, request GeneralCommandRequest) error {
+	h.general <- request
+	return nil
+}
+
+// TestRemoteSessionDispatchesCommands runs a RemoteSession against a local stand-in for the Jellyfin WebSocket
+func TestRemoteSessionDispatchesCommands(t *testing.T) {
+	keepAlive := make(chan struct{}, 1)
+	messages := []string{
+		`{"MessageType":"ForceKeepAlive","Data":1}`,
+		`{"MessageType":"Playstate","Data":{"Command":"Seek","SeekPositionTicks":600000000}}`,
+		`{"MessageType":"Play","Data":{"ItemIds":["a","b"],"PlayCommand":"PlayNow","StartIndex":1}}`,
+		`{"MessageType":"GeneralCommand","Data":{"Name":"SetVolume","Arguments":{"Volume":"40"}}}`,
+	}
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/socket" || r.URL.Query().Get("api_key") != "token" ||
+			r.URL.Query().Get("deviceId") != "device" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func(conn *websocket.Conn) { _ = conn.Close() }(conn)
+		for _, message := range messages {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+				return
+			}
+		}
+		for {
+			var msg socketMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.MessageType == "KeepAlive" {
+				select {
+				case keepAlive <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	client := NewJellyPotClient(server.URL, "user", "password", "device")
+	client.setAuthState("token", "session", "user")
+	handler := newFakeRemoteHandler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewRemoteSession(client, handler).Run(ctx)
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case request := <-handler.playstate:
+		if request.Command != "Seek" || request.SeekPositionTicks != 600000000 {
+			t.Errorf("playstate = %+v, want Seek to 600000000", request)
+		}
+	case <-timeout:
+		t.Fatal("no Playstate command received")
+	}
+	select {
+	case request := <-handler.play:
+		if request.PlayCommand != "PlayNow" || len(request.ItemIds) != 2 || request.StartIndex != 1 {
+			t.Errorf("play = %+v, want PlayNow of 2 items from index 1", request)
+		}
+	case <-timeout:
+		t.Fatal("no Play command received")
+	}
+	select {
+	case request := <-handler.general:
+		if request.Name != "SetVolume" || request.Arguments["Volume"] != "40" {
+			t.Errorf("general command = %+v, want SetVolume 40", request)
+		}
+	case <-timeout:
+		t.Fatal("no GeneralCommand received")
+	}
+	select {
+	case <-keepAlive:
+	case <-timeout:
+		t.Fatal("no KeepAlive sent after ForceKeepAlive")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how often and how long to wait before retrying transient failures
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy keeps retries short enough to fit inside a reporting interval
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  5 * time.Second,
+}
+
+// Do runs op until it succeeds, fails permanently, runs out of attempts or ctx is done
+func (p RetryPolicy) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < max(p.Attempts, 1); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(p.delay(attempt)):
+			}
+		}
+		if err = op(ctx); err == nil || !isTransient(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// delay returns the jittered exponential backoff before the given attempt
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// Equal jitter: half fixed, half random, so concurrent clients spread out
+	return d/2 + rand.N(d/2+1)
+}
+
+// isTransient reports whether an error is worth retrying
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
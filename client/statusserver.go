@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// StartStatusServer serves the playback status of bridge over HTTP on a loopback address until ctx is done
+//
+//	GET /status   BridgeStatus as JSON
+//	GET /healthz  200 while the instance is running
+func StartStatusServer(ctx context.Context, address string, bridge *Bridge) error {
+	if err := checkLoopbackAddress(address); err != nil {
+		return fmt.Errorf("invalid status address: %w", err)
+	}
+	return serveHTTP(ctx, "status server", address, newStatusHandler(bridge))
+}
+
+// serveHTTP serves handler on address in the background until ctx is done
+func serveHTTP(ctx context.Context, name, address string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("http server stopped", "name", name, "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	return nil
+}
+
+// newStatusHandler returns the routes of the status server
+func newStatusHandler(bridge *Bridge) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, bridge.Status())
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return mux
+}
+
+// writeJSON writes value as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, code int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// checkLoopbackAddress checks that address is a host:port only reachable from this machine
+func checkLoopbackAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("must be host:port, such as 127.0.0.1:8099: %w", err)
+	}
+	if port == "" {
+		return errors.New("must include a port, such as 127.0.0.1:8099")
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("host %q must be a loopback address, such as 127.0.0.1 or localhost", host)
+	}
+	return nil
+}
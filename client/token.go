@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// CachedToken is an access token kept between runs so a launch can skip the login
+type CachedToken struct {
+	ServerUrl   string `json:"serverUrl"`
+	Username    string `json:"username"`
+	AccessToken string `json:"accessToken"`
+	UserId      string `json:"userId"`
+}
+
+// loadCachedToken reads the token stored at path, returning nil when there is none
+func loadCachedToken(path string) *CachedToken {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("failed to read token cache", "path", path, "error", err)
+		}
+		return nil
+	}
+	var token CachedToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		slog.Warn("failed to parse token cache", "path", path, "error", err)
+		return nil
+	}
+	return &token
+}
+
+// save writes the token to path, readable by the current user only
+func (t *CachedToken) save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// UseTokenCache restores the access token cached at path when it belongs to the configured server
+// and user, and keeps the cache up to date on every later authentication
+// A client that is already logged in saves its token instead
+func (c *JellyPotClient) UseTokenCache(path string) {
+	c.tokenPath = path
+	if c.token() != "" {
+		c.saveToken()
+		return
+	}
+	c.restoreToken(path)
+}
+
+// restoreToken uses the access token cached at path when it belongs to the configured server and user,
+// without writing the cache afterwards
+func (c *JellyPotClient) restoreToken(path string) {
+	token := loadCachedToken(path)
+	if token == nil || token.AccessToken == "" || !c.hasServerUrl(token.ServerUrl) ||
+		token.Username != c.username {
+		return
+	}
+	c.setAuthState(token.AccessToken, "", token.UserId)
+}
+
+// saveToken writes the current access token to the token cache, if one is in use
+func (c *JellyPotClient) saveToken() {
+	if c.tokenPath == "" {
+		return
+	}
+	accessToken, _, userId := c.authState()
+	token := CachedToken{
+		ServerUrl:   c.ServerUrl(),
+		Username:    c.username,
+		AccessToken: accessToken,
+		UserId:      userId,
+	}
+	if err := token.save(c.tokenPath); err != nil {
+		slog.Warn("failed to save token cache", "path", c.tokenPath, "error", err)
+	}
+}
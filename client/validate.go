@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Bounds of reporting-interval; Jellyfin drops sessions that stay silent for too long
+const (
+	MinReportingInterval = time.Second
+	MaxReportingInterval = 5 * time.Minute
+)
+
+// SamplePlaceholder is the value the sample config.yaml uses for settings that must be filled in
+const SamplePlaceholder = "string"
+
+// ConfigProblem is a single invalid setting
+type ConfigProblem struct {
+	Key     string
+	Message string
+}
+
+// ConfigError lists every invalid setting found by Validate
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, problem := range e.Problems {
+		fmt.Fprintf(&b, "\n  - %s: %s", problem.Key, problem.Message)
+	}
+	return b.String()
+}
+
+// Validate checks the selected profile and the player settings, reporting all problems at once
+func (c *JellyPotConfig) Validate() error {
+	return c.validate(true)
+}
+
+// ValidateExceptServer is Validate without the server URLs, for a profile whose server is yet to be discovered
+func (c *JellyPotConfig) ValidateExceptServer() error {
+	return c.validate(false)
+}
+
+// validate checks the configuration, including the server URLs when checkServer is set
+func (c *JellyPotConfig) validate(checkServer bool) error {
+	var problems []ConfigProblem
+	add := func(key, format string, args ...any) {
+		problems = append(problems, ConfigProblem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.ReportingInterval < MinReportingInterval || c.ReportingInterval > MaxReportingInterval {
+		add("reporting-interval", "must be between %s and %s, got %s",
+			MinReportingInterval, MaxReportingInterval, c.ReportingInterval)
+	}
+
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		add("log-level", "%v", err)
+	}
+
+	if c.StatusAddress != "" {
+		if err := checkLoopbackAddress(c.StatusAddress); err != nil {
+			add("status-address", "%v", err)
+		}
+	}
+
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			add("metrics-address", "must be host:port, such as :9470: %v", err)
+		}
+	}
+
+	playerKey := "pot-player-path"
+	if c.Servers[c.profile].PotPlayerPath != "" {
+		playerKey = c.profileKey + ".pot-player-path"
+	}
+	if err := checkExecutable(c.PotPlayerPath); err != nil {
+		add(playerKey, "%v", err)
+	}
+
+	argsKey := "launch-args"
+	if len(c.Servers[c.profile].LaunchArgs) > 0 {
+		argsKey = c.profileKey + ".launch-args"
+	}
+	if err := checkLaunchArgs(c.launchArgs()); err != nil {
+		add(argsKey, "%v", err)
+	}
+
+	if checkServer {
+		urls := c.Jellyfin.urls()
+		if len(urls) == 0 {
+			add(c.profileKey+".server-url", "is required")
+		}
+		for i, u := range urls {
+			key := c.profileKey + ".server-url"
+			if c.Jellyfin.ServerUrl == "" || i > 0 {
+				key = c.profileKey + ".server-urls"
+			}
+			if err := checkServerUrl(u); err != nil {
+				add(key, "%v", err)
+			}
+		}
+	}
+
+	switch username := strings.TrimSpace(c.Jellyfin.Username); {
+	case username == "":
+		add(c.profileKey+".username", "is required")
+	case username == SamplePlaceholder:
+		add(c.profileKey+".username", "is still the sample value %q", SamplePlaceholder)
+	}
+	switch {
+	case c.Jellyfin.Password == SamplePlaceholder:
+		add(c.profileKey+".password", "is still the sample value %q", SamplePlaceholder)
+	case c.Jellyfin.Password == "" && !c.hasCachedToken():
+		add(c.profileKey+".password", "is required unless logged in with Quick Connect through init")
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// hasCachedToken reports whether a login token is cached for the selected profile
+func (c *JellyPotConfig) hasCachedToken() bool {
+	token := loadCachedToken(c.DataPath("token.json"))
+	return token != nil && token.AccessToken != ""
+}
+
+// checkServerUrl checks that a server URL is an absolute http or https URL
+func checkServerUrl(serverUrl string) error {
+	u, err := url.Parse(serverUrl)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL %q must start with http:// or https://", serverUrl)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL %q has no host", serverUrl)
+	}
+	return nil
+}
+
+// checkExecutable checks that path names a program that can be launched
+func checkExecutable(path string) error {
+	switch strings.TrimSpace(path) {
+	case "":
+		return errors.New("is required")
+	case SamplePlaceholder:
+		return fmt.Errorf("is still the sample value %q", SamplePlaceholder)
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("file %q does not exist", path)
+		}
+		return err
+	}
+	if !isExecutableFile(path) {
+		return fmt.Errorf("%q is not an executable file", path)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidate checks that every invalid setting is reported under its own key
+func TestValidate(t *testing.T) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	t.Setenv("LOCALAPPDATA", dataHome)
+	player, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *JellyPotConfig)
+		token  bool // A login token is cached for the profile
+		except bool // Use ValidateExceptServer
+		want   []ConfigProblem
+	}{
+		{name: "valid", modify: func(c *JellyPotConfig) {}},
+		{
+			name: "sample values",
+			modify: func(c *JellyPotConfig) {
+				c.PotPlayerPath = SamplePlaceholder
+				c.Jellyfin.Username = SamplePlaceholder
+				c.Jellyfin.Password = SamplePlaceholder
+			},
+			want: []ConfigProblem{
+				{"pot-player-path", `is still the sample value "string"`},
+				{"jellyfin.username", `is still the sample value "string"`},
+				{"jellyfin.password", `is still the sample value "string"`},
+			},
+		},
+		{
+			name:   "interval zero",
+			modify: func(c *JellyPotConfig) { c.ReportingInterval = 0 },
+			want:   []ConfigProblem{{"reporting-interval", "must be between 1s and 5m0s, got 0s"}},
+		},
+		{
+			name:   "interval at bounds",
+			modify: func(c *JellyPotConfig) { c.ReportingInterval = MaxReportingInterval },
+		},
+		{
+			name:   "interval too long",
+			modify: func(c *JellyPotConfig) { c.ReportingInterval = MaxReportingInterval + time.Second },
+			want:   []ConfigProblem{{"reporting-interval", "must be between 1s and 5m0s, got 5m1s"}},
+		},
+		{
+			name:   "bad URL scheme",
+			modify: func(c *JellyPotConfig) { c.Jellyfin.ServerUrl = "ftp://jellyfin.lan" },
+			want: []ConfigProblem{
+				{"jellyfin.server-url", `URL "ftp://jellyfin.lan" must start with http:// or https://`},
+			},
+		},
+		{
+			name:   "no server URL",
+			modify: func(c *JellyPotConfig) { c.Jellyfin.ServerUrl = "" },
+			want:   []ConfigProblem{{"jellyfin.server-url", "is required"}},
+		},
+		{
+			name:   "no server URL before discovery",
+			modify: func(c *JellyPotConfig) { c.Jellyfin.ServerUrl = "" },
+			except: true,
+		},
+		{
+			name:   "missing player",
+			modify: func(c *JellyPotConfig) { c.PotPlayerPath = filepath.Join(dataHome, "PotPlayerMini64.exe") },
+			want: []ConfigProblem{
+				{"pot-player-path", `file "` + filepath.Join(dataHome, "PotPlayerMini64.exe") + `" does not exist`},
+			},
+		},
+		{
+			name:   "no password",
+			modify: func(c *JellyPotConfig) { c.Jellyfin.Password = "" },
+			want: []ConfigProblem{
+				{"jellyfin.password", "is required unless logged in with Quick Connect through init"},
+			},
+		},
+		{
+			name:   "no password with cached token",
+			modify: func(c *JellyPotConfig) { c.Jellyfin.Password = "" },
+			token:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &JellyPotConfig{
+				ReportingInterval: 10 * time.Second,
+				PotPlayerPath:     player,
+				Jellyfin: JellyfinConfig{
+					ServerUrl: "http://127.0.0.1:8096",
+					Username:  "user",
+					Password:  "password",
+				},
+			}
+			test.modify(config)
+			config.addDefaultProfile()
+			if err := config.selectProfile(""); err != nil {
+				t.Fatal(err)
+			}
+
+			tokenPath := config.DataPath("token.json")
+			t.Cleanup(func() { _ = os.Remove(tokenPath) })
+			if test.token {
+				if err := (&CachedToken{AccessToken: "token"}).save(tokenPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			validate := config.Validate
+			if test.except {
+				validate = config.ValidateExceptServer
+			}
+			err := validate()
+			var configErr *ConfigError
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Validate() error = %v, want a *ConfigError", err)
+			}
+			if !slices.Equal(configErr.Problems, test.want) {
+				t.Errorf("Validate() problems:\n%s\nwant:\n%s", formatProblems(configErr.Problems),
+					formatProblems(test.want))
+			}
+		})
+	}
+}
+
+// formatProblems lists problems one per line for test failures
+func formatProblems(problems []ConfigProblem) string {
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = "  " + problem.Key + ": " + problem.Message
+	}
+	return strings.Join(lines, "\n")
+}
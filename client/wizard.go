@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// stdin is shared by every console prompt so buffered input is not lost between them
+var stdin = bufio.NewReader(os.Stdin)
+
+// promptLine asks for a line of input, returning def when the answer is empty
+func promptLine(label, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", label, def)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+	line, _ := stdin.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// promptYesNo asks a yes/no question, returning def when the answer is empty
+func promptYesNo(label string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(promptLine(fmt.Sprintf("%s (%s)", label, hint), ""))
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
+
+// promptPassword asks for a password without echoing it
+func promptPassword(label string) string {
+	fmt.Printf("%s: ", label)
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, _ := stdin.ReadString('\n')
+		return strings.TrimRight(line, "\r\n")
+	}
+	password, _ := term.ReadPassword(fd)
+	fmt.Println()
+	return string(password)
+}
+
+// canRunWizard reports whether the setup wizard can ask questions on the console
+func canRunWizard() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// runSetupWizard asks for the server, login and player on the console and writes the config file
+// that configFilePath picks, which is in the per-user config directory unless one exists elsewhere
+func runSetupWizard(ctx context.Context) error {
+	configPath, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configPath); err == nil &&
+		!promptYesNo(fmt.Sprintf("%s already exists, overwrite it?", configPath), false) {
+		return errors.New("setup cancelled")
+	}
+
+	fmt.Println("JellyPotBridge setup")
+	fmt.Println()
+
+	// 1. Server
+	client, err := setupServer(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 2. Login
+	password, err := setupLogin(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	// 3. Player
+	playerPath, err := setupPlayer()
+	if err != nil {
+		return err
+	}
+
+	// 4. Test the connection with the new session
+	if _, err := client.GetSessions(ctx); err != nil {
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+	fmt.Println("Connection test successful")
+
+	// 5. Write the configuration
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.Set("reporting-interval", "10s")
+	v.Set("pot-player-path", playerPath)
+	v.Set("close-player-on-exit", false)
+	v.Set("jellyfin.server-url", client.ServerUrl())
+	v.Set("jellyfin.username", client.username)
+	v.Set("jellyfin.password", password)
+	if err := v.WriteConfigAs(configPath); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	fmt.Printf("Configuration saved to %s\n", configPath)
+
+	// Keep the device ID on this machine and the session, so the first launch does not log in again
+	config, err := readConfig()
+	if err == nil && config.selectProfile("") == nil {
+		if err := config.saveDeviceId(client.deviceId); err != nil {
+			fmt.Printf("Warning: Failed to save device ID: %v\n", err)
+		}
+		client.UseTokenCache(config.DataPath("token.json"))
+	}
+	return nil
+}
+
+// setupServer asks for the server address, offering the servers found on the local network
+func setupServer(ctx context.Context) (*JellyPotClient, error) {
+	deviceId, err := newDeviceId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device ID: %w", err)
+	}
+
+	var serverUrl string
+	if address, err := discoverServerUrl(ctx); err == nil {
+		serverUrl = address
+	} else {
+		fmt.Printf("Discovery: %v\n", err)
+	}
+	for {
+		serverUrl = strings.TrimRight(promptLine("Server URL", serverUrl), "/")
+		if serverUrl == "" {
+			return nil, errors.New("a server URL is required")
+		}
+		client := NewJellyPotClient(serverUrl, "", "", deviceId)
+		if err := client.probe(ctx, serverUrl); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			fmt.Printf("Server is not reachable: %v\n", err)
+			continue
+		}
+		fmt.Println("Server is reachable")
+		return client, nil
+	}
+}
+
+// setupLogin logs in with a password or Quick Connect and returns the password to save
+func setupLogin(ctx context.Context, client *JellyPotClient) (string, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		method := promptLine("Log in with (1) username and password or (2) Quick Connect", "1")
+		switch method {
+		case "1":
+			client.username = promptLine("Username", client.username)
+			client.password = promptPassword("Password")
+			if err := client.Authenticate(ctx); err != nil {
+				fmt.Printf("Login failed: %v\n", err)
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				continue
+			}
+			fmt.Println("Login successful")
+			return client.password, nil
+		case "2":
+			state, err := client.InitiateQuickConnect(ctx)
+			if err != nil {
+				fmt.Printf("Failed to start Quick Connect: %v\n", err)
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				continue
+			}
+			fmt.Printf("Enter the code %s under Quick Connect in a logged-in Jellyfin client...\n", state.Code)
+			if err := client.waitForQuickConnect(ctx, state.Secret); err != nil {
+				return "", err
+			}
+			if err := client.AuthenticateWithQuickConnect(ctx, state.Secret); err != nil {
+				return "", fmt.Errorf("Quick Connect login failed: %w", err)
+			}
+			fmt.Printf("Logged in as %s\n", client.username)
+			fmt.Println("No password is saved; run init again if the session is ever revoked")
+			return "", nil
+		default:
+			fmt.Println("Invalid choice")
+		}
+	}
+	return "", errors.New("login failed")
+}
+
+// setupPlayer asks for the player executable, suggesting an installed PotPlayer
+func setupPlayer() (string, error) {
+	def, _ := DetectPotPlayer()
+	for {
+		path := strings.Trim(promptLine("PotPlayer executable", def), `"`)
+		if path == "" {
+			return "", errors.New("a player executable is required")
+		}
+		if isExecutableFile(path) {
+			return path, nil
+		}
+		fmt.Printf("Not an executable file: %s\n", path)
+	}
+}
+
+// isExecutableFile reports whether path is an existing regular file that can be run
+func isExecutableFile(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(path), ".exe")
+	}
+	return info.Mode().Perm()&0o111 != 0
+}
@@ -1,7 +1,7 @@
 // ==UserScript==
 // @name         JellyPotBridge
 // @namespace    http://tampermonkey.net/
-// @version      1.0.0
+// @version      1.1.0
 // @description  JellyPotBridge
 // @license      MIT
 // @author       @Hattiss
@@ -46,7 +46,7 @@
 
     async function callJellyPot() {
         let itemId = await getItemId();
-        let poturl = `jellypot://${itemId}`;
+        let poturl = `jellypot://${itemId}?server=${encodeURIComponent(ApiClient.serverAddress())}`;
         const iframe = document.createElement('iframe');
         iframe.style.display = 'none';
         iframe.src = poturl;